@@ -0,0 +1,50 @@
+/*
+ * auth.go - authentication to secured Solr servers
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+)
+
+var (
+	solrUser         = flag.String("user", "", "user to authenticate to Solr with, for the BasicAuth plugin")
+	solrPassword     = flag.String("password", "", "password of -user, or a file:, vault: or aws-sm: reference to it; prefer SOLR_STATUS_PASSWORD or -password-file to the password itself, as the command line is visible to other users")
+	solrPasswordFile = flag.String("password-file", "", "file the password of -user is read from, same as -password file:<path>")
+)
+
+// The password of -user, from the flag or the file.
+var basicPassword secret
+
+// Load the credentials to authenticate to Solr with.
+func loadCredentials() error {
+	ref := *solrPassword
+	if *solrPasswordFile != "" {
+		ref = "file:" + *solrPasswordFile
+	}
+	if ref != "" && *solrUser == "" {
+		return fmt.Errorf("a password requires -user")
+	}
+	if err := basicPassword.load(ref); err != nil {
+		return err
+	}
+	if err := loadKerberos(); err != nil {
+		return err
+	}
+	return loadToken()
+}
+
+// Add the credentials to a request to Solr.
+func authenticate(req *http.Request) error {
+	if *solrUser != "" {
+		req.SetBasicAuth(*solrUser, basicPassword.get())
+	}
+	if err := negotiate(req); err != nil {
+		return err
+	}
+	return addToken(req)
+}
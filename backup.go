@@ -0,0 +1,106 @@
+/*
+ * backup.go - backup and snapshot status metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+var (
+	backupStats      = flag.Bool("backup-stats", false, "collect the status, age and size of the most recent backup")
+	backupName       = flag.String("backup-name", "", "name of a collection backup to check with LISTBACKUP (SolrCloud)")
+	backupLocation   = flag.String("backup-location", "", "location of the collection backup")
+	backupRepository = flag.String("backup-repository", "", "repository of the collection backup")
+)
+
+// Collect the status of the most recent backup of the specified core, made
+// through the replication handler.
+func getBackupValues(t *target, core string) ([]Value, error) {
+	data, err := getParsedJson(fmt.Sprintf("%s/%s/replication?command=details&json.nl=map&wt=json",
+		t.baseURL(),
+		url.PathEscape(core)))
+	if err != nil {
+		return nil, err
+	}
+
+	// Cores that were never backed up have no backup details.
+	backup := data.S("details", "backup")
+	if backup == nil {
+		return nil, nil
+	}
+
+	status, _ := backup.S("status").Data().(string)
+	success := 0.0
+	if status == "success" {
+		success = 1
+	}
+	values := []Value{{Type: "gauge", Name: "backup_success", Value: success}}
+
+	if s, ok := backup.S("snapshotCompletedAt").Data().(string); ok {
+		if t, err := parseReplicationDate(s); err != nil {
+			warnf("%v", err)
+		} else {
+			values = append(values, Value{Type: "gauge", Name: "backup_age",
+				Value: time.Since(t).Truncate(time.Second).Seconds()})
+		}
+	}
+	// The replication handler only tells how many files a core backup holds,
+	// not their size, which collection backups alone report.
+	if v, ok := numberValue(backup.S("fileCount")); ok {
+		values = append(values, Value{Type: "gauge", Name: "backup_files", Value: v})
+	}
+
+	return values, nil
+}
+
+// Collect the age and size of the most recent incremental collection backup
+// named by -backup-name (Solr 8.9 or later), under the "backup.<name>" plugin
+// instance. Only completed backups are listed, so the last one is always a
+// success.
+func getCollectionBackupValues(t *target, core string) ([]Value, error) {
+	if *backupName == "" {
+		return nil, nil
+	}
+	params := url.Values{"action": {"LISTBACKUP"}, "name": {*backupName}, "wt": {"json"}}
+	if *backupLocation != "" {
+		params.Set("location", *backupLocation)
+	}
+	if *backupRepository != "" {
+		params.Set("repository", *backupRepository)
+	}
+
+	data, err := getParsedJson(t.baseURL() + "/admin/collections?" + params.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	backups := data.S("backups").Children()
+	instance := "backup." + metricName(*backupName)
+	if len(backups) == 0 {
+		return []Value{{Instance: instance, Type: "gauge", Name: "backup_success", Value: 0}}, nil
+	}
+
+	last := backups[len(backups)-1]
+	values := []Value{{Instance: instance, Type: "gauge", Name: "backup_success", Value: 1}}
+	if s, ok := last.S("endTime").Data().(string); ok {
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			values = append(values, Value{Instance: instance, Type: "gauge", Name: "backup_age",
+				Value: time.Since(t).Truncate(time.Second).Seconds()})
+		}
+	}
+	if v, ok := last.S("indexSizeMB").Data().(float64); ok {
+		values = append(values, Value{Instance: instance, Type: "gauge", Name: "backup_size",
+			Value: float64(int64(v * (1 << 20)))})
+	}
+	if v, ok := last.S("indexFileCount").Data().(float64); ok {
+		values = append(values, Value{Instance: instance, Type: "gauge", Name: "backup_files", Value: v})
+	}
+
+	return values, nil
+}
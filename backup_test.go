@@ -0,0 +1,62 @@
+/*
+ * backup_test.go - tests of the backup and snapshot status metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBackupValues(t *testing.T) {
+	defer func(name string) { *backupName = name }(*backupName)
+	*backupName = "nightly"
+
+	// LISTBACKUP is not asked for by the core collector, and its failure is
+	// not that of the core.
+	target := newTestTarget(t, map[string]string{
+		"/products/replication": `{"details": {"backup": {"status": "success", "fileCount": 12}}}`,
+	})
+	values, err := getBackupValues(target, "products")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Value{
+		{Type: "gauge", Name: "backup_success", Value: 1},
+		{Type: "gauge", Name: "backup_files", Value: 12},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("getBackupValues() = %v, expected %v", values, expected)
+	}
+}
+
+func TestCollectionBackupValues(t *testing.T) {
+	defer func(name string) { *backupName = name }(*backupName)
+
+	tests := []struct {
+		name, reply string
+		expected    []Value
+	}{
+		{"", `{}`, nil},
+		{"nightly", `{"backups": []}`, []Value{
+			{Instance: "backup.nightly", Type: "gauge", Name: "backup_success", Value: 0},
+		}},
+		{"nightly", `{"backups": [{"indexSizeMB": 1, "indexFileCount": 3}, {"indexSizeMB": 2, "indexFileCount": 5}]}`, []Value{
+			{Instance: "backup.nightly", Type: "gauge", Name: "backup_success", Value: 1},
+			{Instance: "backup.nightly", Type: "gauge", Name: "backup_size", Value: 2 << 20},
+			{Instance: "backup.nightly", Type: "gauge", Name: "backup_files", Value: 5},
+		}},
+	}
+	for _, test := range tests {
+		*backupName = test.name
+		values, err := getCollectionBackupValues(newTestTarget(t, map[string]string{"/admin/collections": test.reply}), "products")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(values, test.expected) {
+			t.Errorf("getCollectionBackupValues(%s) = %v, expected %v", test.reply, values, test.expected)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+/*
+ * breaker.go - circuit breaker suspending the polling of failing targets
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"time"
+)
+
+var (
+	breakerFailures = flag.Int("breaker-failures", 0, "suspend polling a server for -breaker-cooldown after it failed on that many cycles in a row (0 never does)")
+	breakerCooldown = flag.Duration("breaker-cooldown", 5*time.Minute, "how long polling a server is suspended for, see -breaker-failures")
+)
+
+// Tell whether polling the target is suspended.
+func (t *target) circuitOpen(now time.Time) bool {
+	return now.Before(t.openUntil)
+}
+
+// Suspend polling the target once it failed on too many cycles in a row.
+// The cycle following the cooldown polls it again, which suspends it for
+// another cooldown should it fail still.
+func (t *target) tripBreaker(now time.Time) {
+	if *breakerFailures > 0 && t.failed && t.failures >= *breakerFailures {
+		t.openUntil = now.Add(*breakerCooldown)
+		warnf("%s: failed on %d cycles in a row, not polled for %v", t.server, t.failures, *breakerCooldown)
+	}
+}
+
+// Return whether the target is polled, when the breaker is enabled.
+func (t *target) breakerValues(now time.Time) []Value {
+	if *breakerFailures == 0 {
+		return nil
+	}
+	available := 1.0
+	if t.circuitOpen(now) {
+		available = 0
+	}
+	return []Value{{Type: "gauge", Name: "available", Value: available}}
+}
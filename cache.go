@@ -0,0 +1,93 @@
+/*
+ * cache.go - searcher cache statistics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/Jeffail/gabs"
+)
+
+var (
+	cacheStats      = flag.Bool("cache-stats", false, "collect filterCache, queryResultCache and documentCache stats")
+	fieldCacheStats = flag.Bool("fieldcache-stats", false, "collect fieldCache entry count and fieldValueCache stats")
+)
+
+var cacheNames = []string{"filterCache", "queryResultCache", "documentCache"}
+
+// Cache stats we report, keyed by their name in the metrics API.
+var cacheFields = map[string]string{
+	"size":       "size",
+	"hits":       "hits",
+	"lookups":    "lookups",
+	"inserts":    "inserts",
+	"hitratio":   "hitratio",
+	"evictions":  "evictions",
+	"warmupTime": "warmuptime",
+}
+
+// Cache stats which are counters, reported as derives. They are read from
+// their cumulative version when there is one, as the others start again from
+// zero with every new searcher.
+var cacheCounters = map[string]bool{"hits": true, "lookups": true, "inserts": true, "evictions": true}
+
+// Collect the searcher caches stats of the specified core.
+func getCacheValues(t *target, core string) ([]Value, error) {
+	registry, err := getCoreMetrics(t, core, "CACHE.searcher")
+	if err != nil {
+		return nil, err
+	}
+
+	var values []Value
+	for _, cache := range cacheNames {
+		values = append(values, cacheValues(registry.S("CACHE.searcher."+cache), cache)...)
+	}
+	return values, nil
+}
+
+// Collect the fieldCache entry count and the fieldValueCache stats of the
+// specified core. An ever growing fieldCache usually means sorting or faceting
+// on fields without docValues.
+func getFieldCacheValues(t *target, core string) ([]Value, error) {
+	registry, err := getCoreMetrics(t, core, "CACHE.core.fieldCache", "CACHE.searcher.fieldValueCache")
+	if err != nil {
+		return nil, err
+	}
+
+	var values []Value
+	if v, ok := registry.S("CACHE.core.fieldCache", "entries_count").Data().(float64); ok {
+		values = append(values, Value{Type: "gauge", Name: "fieldcache_entries", Value: v})
+	}
+	values = append(values, cacheValues(registry.S("CACHE.searcher.fieldValueCache"), "fieldValueCache")...)
+	return values, nil
+}
+
+// Return the stats of a cache as values, named after the cache.
+func cacheValues(stats *gabs.Container, cache string) []Value {
+	var values []Value
+	for _, field := range sortedKeys(stats) {
+		name, ok := cacheFields[field]
+		if !ok {
+			continue
+		}
+		typ := "gauge"
+		if cacheCounters[field] {
+			typ = "derive"
+			if stats.Exists("cumulative_" + field) {
+				field = "cumulative_" + field
+			}
+		}
+		if v, ok := stats.S(field).Data().(float64); ok {
+			values = append(values, Value{
+				Type:  typ,
+				Name:  strings.ToLower(cache) + "_" + name,
+				Value: v,
+			})
+		}
+	}
+	return values
+}
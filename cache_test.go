@@ -0,0 +1,44 @@
+/*
+ * cache_test.go - tests of the searcher cache statistics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Jeffail/gabs"
+)
+
+func TestCacheValues(t *testing.T) {
+	tests := []struct {
+		stats    string
+		expected []Value
+	}{
+		{`{}`, nil},
+		{`{"size": 10, "hits": 3, "lookups": 4, "inserts": 1, "evictions": 0, "hitratio": 0.75, "warmupTime": 5}`, []Value{
+			{Type: "derive", Name: "filtercache_evictions", Value: 0},
+			{Type: "gauge", Name: "filtercache_hitratio", Value: 0.75},
+			{Type: "derive", Name: "filtercache_hits", Value: 3},
+			{Type: "derive", Name: "filtercache_inserts", Value: 1},
+			{Type: "derive", Name: "filtercache_lookups", Value: 4},
+			{Type: "gauge", Name: "filtercache_size", Value: 10},
+			{Type: "gauge", Name: "filtercache_warmuptime", Value: 5},
+		}},
+		{`{"hits": 3, "cumulative_hits": 300, "lookups": 4, "cumulative_lookups": 400, "maxRamMB": 100}`, []Value{
+			{Type: "derive", Name: "filtercache_hits", Value: 300},
+			{Type: "derive", Name: "filtercache_lookups", Value: 400},
+		}},
+	}
+	for _, test := range tests {
+		stats, err := gabs.ParseJSON([]byte(test.stats))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if values := cacheValues(stats, "filterCache"); !reflect.DeepEqual(values, test.expected) {
+			t.Errorf("cacheValues(%s) = %v, expected %v", test.stats, values, test.expected)
+		}
+	}
+}
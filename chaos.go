@@ -0,0 +1,56 @@
+/*
+ * chaos.go - hidden test mode injecting latency and failures
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// These flags are meant to validate alerting rules and are left out of the usage message.
+var (
+	injectLatency  = flag.Duration("inject-latency", 0, "delay every HTTP call by a random duration up to this value")
+	injectFailures = flag.Float64("inject-failures", 0, "fail HTTP calls with this probability (0 to 1)")
+)
+
+var hiddenFlags = map[string]bool{
+	"inject-latency":  true,
+	"inject-failures": true,
+}
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+		visible := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+		flag.VisitAll(func(f *flag.Flag) {
+			if !hiddenFlags[f.Name] {
+				visible.Var(f.Value, f.Name, f.Usage)
+				visible.Lookup(f.Name).DefValue = f.DefValue
+			}
+		})
+		visible.SetOutput(flag.CommandLine.Output())
+		visible.PrintDefaults()
+		fmt.Fprintf(flag.CommandLine.Output(), "\nEvery flag can also be set with a %s environment variable, e.g. %s.\n",
+			envPrefix+"<FLAG>", envName("cache-stats"))
+	}
+}
+
+// Randomly delay and/or fail an HTTP call, as requested by the test flags.
+func injectChaos(url string) error {
+	if *injectLatency > 0 {
+		select {
+		case <-time.After(time.Duration(rand.Int63n(int64(*injectLatency)))):
+		case <-cycleContext.Done():
+		}
+	}
+	if *injectFailures > 0 && rand.Float64() < *injectFailures {
+		return fmt.Errorf("cannot fetch url: injected failure for %s", url)
+	}
+	return nil
+}
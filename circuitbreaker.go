@@ -0,0 +1,45 @@
+/*
+ * circuitbreaker.go - Solr 9 circuit breaker metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"strings"
+)
+
+var circuitBreakerStats = flag.Bool("circuitbreaker-stats", false, "collect circuit breaker trip counts per core and node (Solr 9)")
+
+// The trip counters of the circuit breakers, by kind of breaker.
+var circuitBreakerMetrics = []struct {
+	kind, key string
+}{
+	{"memory", "CIRCUIT_BREAKER.MemoryCircuitBreaker.tripped"},
+	{"cpu", "CIRCUIT_BREAKER.CPUCircuitBreaker.tripped"},
+	{"load", "CIRCUIT_BREAKER.LoadAverageCircuitBreaker.tripped"},
+}
+
+// Collect how many requests were rejected by the circuit breakers, by kind of
+// breaker, for every core and the node. Breakers which are not enabled have
+// no counter, and are not reported.
+func getCircuitBreakerValues(t *target, core string) ([]Value, error) {
+	registries, err := getMetrics(t, "core,node", "CIRCUIT_BREAKER.")
+	if err != nil {
+		return nil, err
+	}
+
+	var values []Value
+	for _, registry := range sortedKeys(registries) {
+		metrics := registries.S(registry)
+		instance := strings.TrimPrefix(registry, "solr.")
+		for _, m := range circuitBreakerMetrics {
+			if v, ok := metricCount(metrics.S(m.key)); ok {
+				values = append(values, Value{Instance: instance, Type: "derive",
+					Name: "circuitbreaker_" + m.kind + "_trips", Value: v})
+			}
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,40 @@
+/*
+ * circuitbreaker_test.go - tests of the circuit breaker metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCircuitBreakerValues(t *testing.T) {
+	tests := []struct {
+		reply    string
+		expected []Value
+	}{
+		{`{"metrics": {}}`, nil},
+		{`{"metrics": {"solr.core.products": {
+			"CIRCUIT_BREAKER.MemoryCircuitBreaker.tripped": 3,
+			"CIRCUIT_BREAKER.CPUCircuitBreaker.tripped": {"count": 2},
+			"CIRCUIT_BREAKER.MemoryCircuitBreaker.threshold": 95
+		}, "solr.node": {
+			"CIRCUIT_BREAKER.LoadAverageCircuitBreaker.tripped": 1
+		}}}`, []Value{
+			{Instance: "core.products", Type: "derive", Name: "circuitbreaker_memory_trips", Value: 3},
+			{Instance: "core.products", Type: "derive", Name: "circuitbreaker_cpu_trips", Value: 2},
+			{Instance: "node", Type: "derive", Name: "circuitbreaker_load_trips", Value: 1},
+		}},
+	}
+	for _, test := range tests {
+		values, err := getCircuitBreakerValues(newTestTarget(t, map[string]string{"/admin/metrics": test.reply}), "products")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(values, test.expected) {
+			t.Errorf("getCircuitBreakerValues(%s) = %v, expected %v", test.reply, values, test.expected)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+/*
+ * client.go - long-lived HTTP clients of the Solr servers
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"context"
+	"flag"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	idleTimeout     = flag.Duration("idle-timeout", 2*time.Minute, "how long idle connections to a Solr server are kept open for the following requests (longer than the interval, for them to be reused)")
+	dialTimeout     = flag.Duration("dial-timeout", 0, "how long connecting to a Solr server may take (-timeout by default)")
+	tlsTimeout      = flag.Duration("tls-timeout", 0, "how long the TLS handshake with a Solr server may take (-timeout by default)")
+	responseTimeout = flag.Duration("response-timeout", 0, "how long a Solr server may take to start replying to a request (-timeout by default)")
+	cycleTimeout    = flag.Duration("cycle-timeout", 0, "how long the requests of a cycle may take altogether, after which the ones left fail (unlimited by default)")
+	idleConns       = flag.Int("idle-conns", 4, "how many idle connections to each Solr server are kept open (0 closes every connection after its request)")
+)
+
+// Context of the requests of the current cycle, canceled at its deadline.
+var cycleContext = context.Background()
+
+// Start the deadline of the requests of a cycle, if any. The returned
+// function ends the cycle.
+func startCycle(start time.Time) context.CancelFunc {
+	if *cycleTimeout == 0 {
+		cycleContext = context.Background()
+		return func() {}
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), start.Add(*cycleTimeout))
+	cycleContext = ctx
+	return cancel
+}
+
+// The client of every Solr server requests were sent to, by host:port.
+var (
+	solrClients      = make(map[string]*http.Client)
+	solrClientsMutex sync.Mutex
+)
+
+// Return the client of the requests to a Solr server. Each has its own pool
+// of connections, which are kept alive between cycles.
+func solrClient(host string) *http.Client {
+	solrClientsMutex.Lock()
+	defer solrClientsMutex.Unlock()
+
+	c := solrClients[host]
+	if c == nil {
+		transport := solrTransport.Clone()
+		transport.DialContext = (&net.Dialer{Timeout: *dialTimeout, KeepAlive: 30 * time.Second}).DialContext
+		transport.TLSHandshakeTimeout = *tlsTimeout
+		transport.ResponseHeaderTimeout = *responseTimeout
+		transport.MaxIdleConnsPerHost = *idleConns
+		transport.IdleConnTimeout = *idleTimeout
+		transport.DisableKeepAlives = *idleConns == 0
+		c = &http.Client{Timeout: httpTimeout(), Transport: transport}
+		solrClients[host] = c
+	}
+	return c
+}
+
+// Forget the clients and close their idle connections, for new settings to
+// be used by the following requests.
+func resetClients() {
+	solrClientsMutex.Lock()
+	defer solrClientsMutex.Unlock()
+
+	for host, c := range solrClients {
+		c.CloseIdleConnections()
+		delete(solrClients, host)
+	}
+}
@@ -0,0 +1,217 @@
+/*
+ * cloud.go - SolrCloud cluster status metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"sort"
+
+	"github.com/Jeffail/gabs"
+)
+
+var (
+	clusterStats    = flag.Bool("cluster-stats", false, "collect per-collection shard and replica counts from CLUSTERSTATUS (SolrCloud)")
+	collectionStats = flag.Bool("collection-stats", false, "collect per-collection document and size totals from the shard leaders (SolrCloud)")
+	leaderStats     = flag.Bool("leader-stats", false, "collect how many shard leaders each node hosts (SolrCloud)")
+)
+
+var replicaStates = []string{"active", "recovering", "down", "recovery_failed"}
+
+// Query the collections API for the status of the whole cluster.
+func getClusterStatus(t *target) (*gabs.Container, error) {
+	data, err := getParsedJson(t.baseURL() + "/admin/collections?action=CLUSTERSTATUS&wt=json")
+	if err != nil {
+		return nil, err
+	}
+
+	cluster := data.S("cluster")
+	if cluster == nil {
+		return nil, fmt.Errorf("no cluster status found in the reply (is Solr running in SolrCloud mode?)")
+	}
+	return cluster, nil
+}
+
+// Collect the shard and replica counts of every collection in the cluster,
+// with replicas counted by state.
+func getClusterValues(t *target, core string) ([]Value, error) {
+	cluster, err := getClusterStatus(t)
+	if err != nil {
+		return nil, err
+	}
+
+	liveNodes := make(map[string]bool)
+	for _, node := range cluster.S("live_nodes").Children() {
+		if name, ok := node.Data().(string); ok {
+			liveNodes[name] = true
+		}
+	}
+	values := []Value{{Instance: "cluster", Type: "gauge", Name: "live_nodes", Value: float64(len(liveNodes))}}
+
+	collections := cluster.S("collections")
+	for _, name := range sortedKeys(collections) {
+		shards := collections.S(name, "shards")
+		instance := "collection." + name
+
+		replicas := 0
+		states := make(map[string]int)
+		for _, shard := range shards.ChildrenMap() {
+			for _, replica := range shard.S("replicas").ChildrenMap() {
+				replicas++
+				state, _ := replica.S("state").Data().(string)
+
+				// A replica whose node died keeps its last published state.
+				if node, ok := replica.S("node_name").Data().(string); ok && !liveNodes[node] {
+					state = "down"
+				}
+				states[state]++
+			}
+		}
+
+		values = append(values,
+			Value{Instance: instance, Type: "gauge", Name: "shards", Value: float64(len(shards.ChildrenMap()))},
+			Value{Instance: instance, Type: "gauge", Name: "replicas", Value: float64(replicas)})
+		for _, state := range replicaStates {
+			values = append(values, Value{Instance: instance, Type: "gauge", Name: "replicas_" + state,
+				Value: float64(states[state])})
+		}
+		values = append(values, Value{Instance: instance, Type: "gauge", Name: "replicas_not_active",
+			Value: float64(replicas - states["active"])})
+	}
+
+	return values, nil
+}
+
+// Collect the numDocs, deletedDocs and sizeInBytes totals of every collection.
+// Only shard leaders are counted, so that replicas are not counted twice.
+func getCollectionDocValues(t *target, core string) ([]Value, error) {
+	cluster, err := getClusterStatus(t)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []Value
+	collections := cluster.S("collections")
+	for _, name := range sortedKeys(collections) {
+		var numDocs, deletedDocs, sizeInBytes float64
+		complete := true
+
+		for _, shard := range collections.S(name, "shards").ChildrenMap() {
+			leader := shardLeader(shard)
+			if leader == nil {
+				complete = false
+				continue
+			}
+			base, _ := leader.S("base_url").Data().(string)
+			leaderCore, _ := leader.S("core").Data().(string)
+
+			index, err := getCoreIndex(base, leaderCore)
+			if err != nil {
+				warnf("collection %s: %v", name, err)
+				complete = false
+				continue
+			}
+			n, _ := index.S("numDocs").Data().(float64)
+			d, _ := index.S("deletedDocs").Data().(float64)
+			s, _ := index.S("sizeInBytes").Data().(float64)
+			numDocs += n
+			deletedDocs += d
+			sizeInBytes += s
+		}
+
+		// Partial totals would show up as drops in the graphs.
+		if !complete {
+			continue
+		}
+		instance := "collection." + name
+		values = append(values,
+			Value{Instance: instance, Type: "gauge", Name: "numdocs", Value: numDocs},
+			Value{Instance: instance, Type: "gauge", Name: "deleteddocs", Value: deletedDocs},
+			Value{Instance: instance, Type: "gauge", Name: "sizeinbytes", Value: sizeInBytes})
+	}
+
+	return values, nil
+}
+
+// Collect how many shard leaders each node hosts, per collection and cluster-wide.
+// Live nodes hosting no leader are reported too, so that skew is visible.
+func getLeaderValues(t *target, core string) ([]Value, error) {
+	cluster, err := getClusterStatus(t)
+	if err != nil {
+		return nil, err
+	}
+
+	total := make(map[string]int)
+	for _, node := range cluster.S("live_nodes").Children() {
+		if name, ok := node.Data().(string); ok {
+			total[name] = 0
+		}
+	}
+
+	var values []Value
+	collections := cluster.S("collections")
+	for _, name := range sortedKeys(collections) {
+		leaders := make(map[string]int)
+		for node := range total {
+			leaders[node] = 0
+		}
+		for _, shard := range collections.S(name, "shards").ChildrenMap() {
+			if leader := shardLeader(shard); leader != nil {
+				node, _ := leader.S("node_name").Data().(string)
+				leaders[node]++
+				total[node]++
+			}
+		}
+		values = append(values, leaderCountValues("collection."+name, leaders)...)
+	}
+	values = append(values, leaderCountValues("cluster", total)...)
+
+	return values, nil
+}
+
+// Return leader counts per node as values, sorted by node name.
+func leaderCountValues(instance string, leaders map[string]int) []Value {
+	nodes := make([]string, 0, len(leaders))
+	for node := range leaders {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	var values []Value
+	for _, node := range nodes {
+		values = append(values, Value{Instance: instance, Type: "gauge", Name: "leaders_" + metricName(node),
+			Value: float64(leaders[node])})
+	}
+	return values
+}
+
+// Return the leader replica of a shard, or nil if it has none.
+func shardLeader(shard *gabs.Container) *gabs.Container {
+	for _, replica := range shard.S("replicas").ChildrenMap() {
+		if boolValue(replica.S("leader")) == 1 {
+			return replica
+		}
+	}
+	return nil
+}
+
+// Query the CoreAdmin STATUS of a core on the given Solr base URL, and
+// return its index stats.
+func getCoreIndex(base, core string) (*gabs.Container, error) {
+	data, err := getParsedJson(fmt.Sprintf("%s/admin/cores?action=STATUS&core=%s&wt=json",
+		base,
+		url.QueryEscape(core)))
+	if err != nil {
+		return nil, err
+	}
+
+	index := data.S("status", core, "index")
+	if index == nil {
+		return nil, fmt.Errorf("no data could be found for the index '%s'", core)
+	}
+	return index, nil
+}
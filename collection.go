@@ -0,0 +1,191 @@
+/*
+ * collection.go - monitoring of every replica of SolrCloud collections
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/Jeffail/gabs"
+)
+
+var collectionNames listFlag
+
+func init() {
+	flag.Var(&collectionNames, "collection", "monitor every replica of the collection, wherever it is hosted (comma-separated or repeated for several collections, SolrCloud)")
+}
+
+// A replica of a monitored collection, and the target hosting it.
+type replica struct {
+	collection string
+	shard      string
+	core       string
+	leader     bool
+	server     string
+	target     *target
+}
+
+// Resolve the monitored collections to their replicas on live nodes, with one
+// target per node. Targets already known are reused, so that what they
+// remember about their cores is kept. The first seed answering
+// CLUSTERSTATUS is used. Aliases are resolved on every cycle, so that the
+// replicas monitored follow the alias when it is moved to another collection,
+// while the collection values keep the alias name.
+func resolveCollections(seeds []*target, known map[string]*target) ([]*target, []replica, error) {
+	seed, cluster, err := firstAnswering(seeds, getClusterStatus)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot resolve collections: %v", err)
+	}
+
+	liveNodes := make(map[string]bool)
+	for _, node := range cluster.S("live_nodes").Children() {
+		if name, ok := node.Data().(string); ok {
+			liveNodes[name] = true
+		}
+	}
+
+	var replicas []replica
+	var servers []string
+	var aliases map[string][]string
+	cores := make(map[string][]string)
+	for _, name := range collectionNames {
+		collections := []string{name}
+		if cluster.S("collections", name) == nil {
+			if aliases == nil {
+				if aliases, err = getAliases(seed); err != nil {
+					return nil, nil, err
+				}
+			}
+			if aliases[name] == nil {
+				return nil, nil, fmt.Errorf("no collection or alias named '%s' could be found", name)
+			}
+			collections = aliases[name]
+		}
+
+		for _, collection := range collections {
+			replicas, servers = collectionReplicas(cluster, liveNodes, name, collection, replicas, servers, cores)
+		}
+	}
+
+	// Nodes which no longer host any replica are forgotten.
+	targets := syncTargets(known, servers)
+	for _, t := range targets {
+		sort.Strings(cores[t.server])
+		t.cores = cores[t.server]
+	}
+	for i := range replicas {
+		replicas[i].target = known[replicas[i].server]
+	}
+
+	return targets, replicas, nil
+}
+
+// Ask the seeds in turn, and return the first one answering along with its
+// reply, or the last error.
+func firstAnswering(seeds []*target, ask func(*target) (*gabs.Container, error)) (*target, *gabs.Container, error) {
+	err := fmt.Errorf("no solr server to ask")
+	for _, seed := range seeds {
+		var reply *gabs.Container
+		if reply, err = ask(seed); err == nil {
+			return seed, reply, nil
+		}
+	}
+	return nil, nil, err
+}
+
+// Append the replicas of a collection on live nodes, reported under the given
+// name, along with the servers hosting them and their cores.
+func collectionReplicas(cluster *gabs.Container, liveNodes map[string]bool, name, collection string,
+	replicas []replica, servers []string, cores map[string][]string) ([]replica, []string) {
+
+	shards := cluster.S("collections", collection, "shards")
+	for _, shard := range sortedKeys(shards) {
+		for _, r := range shards.S(shard, "replicas").ChildrenMap() {
+			node, _ := r.S("node_name").Data().(string)
+			base, _ := r.S("base_url").Data().(string)
+			core, _ := r.S("core").Data().(string)
+			u, err := url.Parse(base)
+			if !liveNodes[node] || core == "" || err != nil || u.Host == "" {
+				continue
+			}
+
+			replicas = append(replicas, replica{collection: name, shard: collection + "/" + shard, core: core,
+				leader: boolValue(r.S("leader")) == 1, server: u.Host})
+			if cores[u.Host] == nil {
+				servers = append(servers, u.Host)
+			}
+			cores[u.Host] = append(cores[u.Host], core)
+		}
+	}
+	return replicas, servers
+}
+
+// Return the collections every alias points to.
+func getAliases(t *target) (map[string][]string, error) {
+	data, err := getParsedJson(t.baseURL() + "/admin/collections?action=LISTALIASES&wt=json")
+	if err != nil {
+		return nil, fmt.Errorf("cannot list aliases: %v", err)
+	}
+
+	aliases := make(map[string][]string)
+	for alias, c := range data.S("aliases").ChildrenMap() {
+		if s, ok := c.Data().(string); ok {
+			aliases[alias] = strings.Split(s, ",")
+		}
+	}
+	return aliases, nil
+}
+
+// Return the totals of every monitored collection, summed over the shard
+// leaders collected on this cycle. A collection with a leader missing is
+// skipped, as partial totals would show up as drops in the graphs.
+func collectionValues(replicas []replica) []Value {
+	var values []Value
+
+	for _, collection := range collectionNames {
+		var numDocs, deletedDocs, segmentCount, sizeInBytes, count float64
+		shards := make(map[string]bool)
+		leaders := make(map[string]bool)
+		complete := true
+
+		for _, r := range replicas {
+			if r.collection != collection {
+				continue
+			}
+			count++
+			shards[r.shard] = true
+			if !r.leader {
+				continue
+			}
+			status := r.target.statuses[r.core]
+			if status == nil {
+				complete = false
+				continue
+			}
+			leaders[r.shard] = true
+			numDocs += float64(status.NumDocs)
+			deletedDocs += float64(status.DeletedDocs)
+			segmentCount += float64(status.SegmentCount)
+			sizeInBytes += float64(status.SizeInBytes)
+		}
+
+		instance := "collection." + collection
+		values = append(values, Value{Instance: instance, Type: "gauge", Name: "replicas_monitored", Value: count})
+		if !complete || len(shards) == 0 || len(leaders) != len(shards) {
+			continue
+		}
+		values = append(values,
+			Value{Instance: instance, Type: "gauge", Name: "numdocs", Value: numDocs},
+			Value{Instance: instance, Type: "gauge", Name: "deleteddocs", Value: deletedDocs},
+			Value{Instance: instance, Type: "gauge", Name: "segmentcount", Value: segmentCount},
+			Value{Instance: instance, Type: "gauge", Name: "sizeinbytes", Value: sizeInBytes})
+	}
+
+	return values
+}
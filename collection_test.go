@@ -0,0 +1,130 @@
+/*
+ * collection_test.go - tests of the collection monitoring
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Jeffail/gabs"
+)
+
+func TestFirstAnswering(t *testing.T) {
+	tests := []struct {
+		answering map[string]bool
+		expected  string // "" when none answers
+	}{
+		{map[string]bool{"a": true, "b": true, "c": true}, "a"},
+		{map[string]bool{"b": true, "c": true}, "b"},
+		{map[string]bool{"c": true}, "c"},
+		{map[string]bool{}, ""},
+	}
+	for _, test := range tests {
+		seeds := []*target{newTarget("a"), newTarget("b"), newTarget("c")}
+		var asked []string
+		ask := func(t *target) (*gabs.Container, error) {
+			asked = append(asked, t.server)
+			if !test.answering[t.server] {
+				return nil, fmt.Errorf("%s is down", t.server)
+			}
+			return gabs.New(), nil
+		}
+
+		seed, reply, err := firstAnswering(seeds, ask)
+		switch {
+		case test.expected == "" && err == nil:
+			t.Errorf("firstAnswering() with %v answering = %s, expected an error", test.answering, seed.server)
+		case test.expected != "" && (err != nil || seed == nil || reply == nil):
+			t.Errorf("firstAnswering() with %v answering: %v, expected %s", test.answering, err, test.expected)
+		case test.expected != "" && seed.server != test.expected:
+			t.Errorf("firstAnswering() with %v answering = %s, expected %s", test.answering, seed.server, test.expected)
+		case test.expected != "" && asked[len(asked)-1] != test.expected:
+			t.Errorf("firstAnswering() with %v answering asked %v after %s answered", test.answering, asked, test.expected)
+		}
+	}
+
+	if _, _, err := firstAnswering(nil, nil); err == nil {
+		t.Errorf("firstAnswering() without seeds: expected an error")
+	}
+}
+
+func TestResolveCollections(t *testing.T) {
+	defer func(names listFlag) { collectionNames = names }(collectionNames)
+
+	down := newTestTarget(t, nil)
+	seed := newTestTarget(t, map[string]string{
+		"/admin/collections?action=LISTALIASES": `{"aliases": {"all": "products_v1,orders", "old": "products_v0"}}`,
+		"/admin/collections?action=CLUSTERSTATUS": `{"cluster": {
+			"live_nodes": ["10.0.0.1:8983_solr", "10.0.0.2:8983_solr"],
+			"collections": {
+				"products_v1": {"shards": {
+					"shard1": {"replicas": {
+						"core_node1": {"node_name": "10.0.0.1:8983_solr", "base_url": "http://10.0.0.1:8983/solr", "core": "products_v1_shard1_replica_n1", "leader": "true"},
+						"core_node2": {"node_name": "10.0.0.3:8983_solr", "base_url": "http://10.0.0.3:8983/solr", "core": "products_v1_shard1_replica_n2"}
+					}},
+					"shard2": {"replicas": {
+						"core_node3": {"node_name": "10.0.0.2:8983_solr", "base_url": "http://10.0.0.2:8983/solr", "core": "products_v1_shard2_replica_n3", "leader": "true"}
+					}}
+				}},
+				"orders": {"shards": {
+					"shard1": {"replicas": {
+						"core_node1": {"node_name": "10.0.0.2:8983_solr", "base_url": "http://10.0.0.2:8983/solr", "core": "orders_shard1_replica_n1", "leader": "true"}
+					}}
+				}}
+			}
+		}}`,
+	})
+
+	tests := []struct {
+		names    listFlag
+		cores    map[string][]string // by server, nil for an error
+		replicas []string            // collection and shard of each replica
+	}{
+		{listFlag{"orders"},
+			map[string][]string{"10.0.0.2:8983": {"orders_shard1_replica_n1"}},
+			[]string{"orders orders/shard1"}},
+		{listFlag{"all"},
+			map[string][]string{
+				"10.0.0.1:8983": {"products_v1_shard1_replica_n1"},
+				"10.0.0.2:8983": {"orders_shard1_replica_n1", "products_v1_shard2_replica_n3"},
+			},
+			[]string{"all products_v1/shard1", "all products_v1/shard2", "all orders/shard1"}},
+		{listFlag{"old"}, map[string][]string{}, nil},
+		{listFlag{"missing"}, nil, nil},
+		{listFlag{"orders", "missing"}, nil, nil},
+	}
+	for _, test := range tests {
+		collectionNames = test.names
+		targets, replicas, err := resolveCollections([]*target{down, seed}, make(map[string]*target))
+		if test.cores == nil {
+			if err == nil || !strings.Contains(err.Error(), "no collection or alias named 'missing'") {
+				t.Errorf("resolveCollections(%v): %v, expected the missing name", test.names, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("resolveCollections(%v): %v", test.names, err)
+			continue
+		}
+
+		cores := make(map[string][]string)
+		for _, target := range targets {
+			cores[target.server] = target.cores
+		}
+		var shards []string
+		for _, r := range replicas {
+			shards = append(shards, r.collection+" "+r.shard)
+			if r.target == nil || r.target.server != r.server {
+				t.Errorf("resolveCollections(%v): replica %s is not polled by its target", test.names, r.core)
+			}
+		}
+		if !reflect.DeepEqual(cores, test.cores) || !reflect.DeepEqual(shards, test.replicas) {
+			t.Errorf("resolveCollections(%v) = %v, %v, expected %v, %v", test.names, cores, shards, test.cores, test.replicas)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ * collectors.go - optional collectors and how often they run
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var collectorIntervalSpecs listFlag
+
+// How often collectors run, by name, when not on every cycle.
+var collectorIntervals map[string]time.Duration
+
+func init() {
+	flag.Var(&collectorIntervalSpecs, "collector-interval", "run a collector less often than every cycle, as name=seconds or name=duration (comma-separated or repeated, e.g. \"segments=5m,cluster=60\")")
+}
+
+// An optional family of values gathered from the Solr server.
+type collector struct {
+	name    string
+	enabled *bool
+	heavy   bool // skipped when above the memory ceiling
+	collect func(t *target, core string) ([]Value, error)
+}
+
+// The optional collectors, run in this order after the status of every core.
+var coreCollectors = []collector{
+	{"cache", cacheStats, false, getCacheValues},
+	{"fieldcache", fieldCacheStats, false, getFieldCacheValues},
+	{"query", queryStats, false, getQueryValues},
+	{"handler", handlerStats, false, getHandlerValues},
+	{"distrib", distribStats, false, getDistribValues},
+	{"component", componentStats, false, getComponentValues},
+	{"update", updateStats, false, getUpdateValues},
+	{"commit", commitStats, false, getCommitValues},
+	{"replication", replicationStats, false, getReplicationValues},
+	{"tlog", tlogStats, false, getTlogValues},
+	{"backup", backupStats, false, getBackupValues},
+	{"disk", diskStats, false, getDiskValues},
+	{"directory", directoryStats, false, getDirectoryValues},
+	{"searcher", searcherStats, false, getSearcherValues},
+	{"segments", segmentStats, true, getSegmentValues},
+	{"merge", mergeStats, false, getMergeValues},
+	{"schema", schemaStats, true, getSchemaValues},
+	{"suggest", suggestStats, false, getSuggestValues},
+}
+
+// The optional collectors whose values are about the whole node or cluster,
+// run once per cycle whatever the number of cores.
+var nodeCollectors = []collector{
+	{"metrics", metricsEnabled, true, getMetricsValues},
+	{"jvm", jvmStats, false, getJVMValues},
+	{"gc", gcStats, false, getGCValues},
+	{"os", osStats, false, getOSValues},
+	{"cpu", cpuStats, false, getCPUValues},
+	{"jetty", jettyStats, false, getJettyValues},
+	{"pool", poolStats, false, getPoolValues},
+	{"circuitbreaker", circuitBreakerStats, false, getCircuitBreakerValues},
+	{"ratelimit", rateLimitStats, false, getRateLimitValues},
+	{"security", securityStats, false, getSecurityValues},
+	{"collectionbackup", backupStats, false, getCollectionBackupValues},
+	{"cluster", clusterStats, true, getClusterValues},
+	{"collection", collectionStats, true, getCollectionDocValues},
+	{"leader", leaderStats, true, getLeaderValues},
+	{"overseer", overseerStats, false, getOverseerValues},
+	{"zookeeper", zkStats, false, getZKValues},
+}
+
+// Parse the -collector-interval overrides.
+func compileCollectorIntervals() error {
+	collectorIntervals = make(map[string]time.Duration)
+	for _, spec := range collectorIntervalSpecs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || findCollector(parts[0]) == nil {
+			return fmt.Errorf("invalid collector interval '%s': expected name=seconds or name=duration with a known collector", spec)
+		}
+		var every durationFlag
+		if err := every.Set(parts[1]); err != nil || every <= 0 {
+			return fmt.Errorf("invalid collector interval '%s': expected a positive number of seconds or duration", spec)
+		}
+		collectorIntervals[parts[0]] = time.Duration(every)
+	}
+	return nil
+}
+
+// Return the collector with the given name, or nil if there is none.
+func findCollector(name string) *collector {
+	for _, list := range [][]collector{coreCollectors, nodeCollectors} {
+		for i := range list {
+			if list[i].name == name {
+				return &list[i]
+			}
+		}
+	}
+	return nil
+}
+
+// Return whether a collector with an interval override is due on the target,
+// for the given core, and remember it ran if so. Half a cycle of slack is
+// allowed, so that it runs on the cycle closest to its interval.
+func (t *target) collectorDue(c collector, core string) bool {
+	every, ok := collectorIntervals[c.name]
+	if !ok {
+		return true
+	}
+	key := c.name + "/" + core
+	slack := pollInterval() / 2
+	if last, ok := t.collectorRuns[key]; ok && time.Since(last)+slack < every {
+		return false
+	}
+	t.collectorRuns[key] = time.Now()
+	return true
+}
@@ -0,0 +1,51 @@
+/*
+ * component.go - search component timing
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+)
+
+var (
+	componentStats  = flag.Bool("component-stats", false, "collect per search component timing (query, facet, highlight, debug) of a probe query")
+	componentParams = flag.String("component-params", "q=*:*&rows=0", "parameters of the probe query timed by -component-stats, e.g. \"q=*:*&rows=10&facet=true&facet.field=cat&hl=true\"")
+)
+
+// Collect how long every search component took to prepare and process a
+// probe query, as reported by debug=timing. Handler metrics only time whole
+// requests, and this is the only way to tell matching, faceting and
+// highlighting apart.
+func getComponentValues(t *target, core string) ([]Value, error) {
+	params, err := url.ParseQuery(*componentParams)
+	if err != nil {
+		return nil, fmt.Errorf("invalid component query parameters: %v", err)
+	}
+	params.Set("debug", "timing")
+	params.Set("wt", "json")
+
+	data, err := getParsedJson(fmt.Sprintf("%s/%s/select?%s", t.baseURL(), url.PathEscape(core), params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	timing := data.S("debug", "timing")
+
+	var values []Value
+	if v, ok := timing.S("time").Data().(float64); ok {
+		values = append(values, Value{Type: "gauge", Name: "component_total_time", Value: v})
+	}
+	for _, phase := range []string{"prepare", "process"} {
+		stats := timing.S(phase)
+		for _, component := range sortedKeys(stats) {
+			if v, ok := stats.S(component, "time").Data().(float64); ok {
+				values = append(values, Value{Type: "gauge",
+					Name: "component_" + metricName(component) + "_" + phase + "_time", Value: v})
+			}
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,206 @@
+/*
+ * config.go - YAML and TOML configuration files
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// Prefix of the environment variables flags can be set with.
+const envPrefix = "SOLR_STATUS_"
+
+var configFile = flag.String("config", "", "YAML or TOML configuration file, whose keys are the flag names (flags given on the command line or in the environment take precedence)")
+
+// Load the configuration file. Every key is the name of a flag, e.g.
+//
+//	server: [solr1:8983, solr2:8983]
+//	core: products
+//	cache-stats: true
+//
+// Lists may be given for the flags accepting several values, and the extra
+// "collectors" key enables collectors by name. Flags already set on the
+// command line or in the environment are left alone, and the others are
+// reset to their default first, so that the file can be loaded again.
+func loadConfig(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %v", err)
+	}
+
+	format, err := configFormat(path)
+	if err != nil {
+		return err
+	}
+	config := make(map[string]interface{})
+	if format == "toml" {
+		err = toml.Unmarshal(b, &config)
+	} else {
+		err = yaml.Unmarshal(b, &config)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot parse config file: %v", err)
+	}
+
+	set := setFlags()
+	flag.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] {
+			return
+		}
+		switch l := f.Value.(type) {
+		case *listFlag:
+			*l = nil
+		case *headerFlag:
+			*l = nil
+		default:
+			f.Value.Set(f.DefValue)
+		}
+	})
+
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		values := configValues(config[key])
+		if key == "collectors" {
+			if err := enableCollectors(values); err != nil {
+				return err
+			}
+			continue
+		}
+
+		f := flag.Lookup(key)
+		if f == nil || key == "config" {
+			return fmt.Errorf("unknown config key '%s'", key)
+		}
+		if set[key] {
+			continue
+		}
+
+		// List flags take their values one at a time, others a comma-separated list.
+		switch f.Value.(type) {
+		case *listFlag, *headerFlag:
+		default:
+			if len(values) == 0 {
+				continue
+			}
+			values = []string{strings.Join(values, ",")}
+		}
+		for _, v := range values {
+			if err := f.Value.Set(v); err != nil {
+				return fmt.Errorf("invalid value '%s' for config key '%s': %v", v, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Parse the command line arguments, then set the flags they do not give from
+// the environment and the configuration file.
+func parseFlags(args []string) error {
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return err
+	}
+	if err := loadEnv(); err != nil {
+		return err
+	}
+	if *configFile != "" {
+		return loadConfig(*configFile)
+	}
+	return nil
+}
+
+// Return the name of the environment variable of a flag, e.g.
+// SOLR_STATUS_CACHE_STATS for -cache-stats.
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// Set the flags not given on the command line from their environment
+// variable, if any. List flags take a comma-separated list.
+func loadEnv() error {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		v, ok := os.LookupEnv(envName(f.Name))
+		if !ok || set[f.Name] || err != nil {
+			return
+		}
+		if e := f.Value.Set(v); e != nil {
+			err = fmt.Errorf("invalid value '%s' for %s: %v", v, envName(f.Name), e)
+		}
+	})
+	return err
+}
+
+// Return the flags set on the command line or in the environment.
+func setFlags() map[string]bool {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	flag.VisitAll(func(f *flag.Flag) {
+		if _, ok := os.LookupEnv(envName(f.Name)); ok {
+			set[f.Name] = true
+		}
+	})
+	return set
+}
+
+// Return a config value as strings, one per element for lists, nil for a
+// null value.
+func configValues(v interface{}) []string {
+	if v == nil {
+		return nil
+	}
+	if list, ok := v.([]interface{}); ok {
+		values := make([]string, 0, len(list))
+		for _, e := range list {
+			values = append(values, fmt.Sprint(e))
+		}
+		return values
+	}
+	return []string{fmt.Sprint(v)}
+}
+
+// Enable the named collectors.
+func enableCollectors(names []string) error {
+	for _, name := range names {
+		c := findCollector(name)
+		if c == nil {
+			return fmt.Errorf("unknown collector '%s'", name)
+		}
+		*c.enabled = true
+	}
+	return nil
+}
+
+// Load the configuration file again, and return the new targets and how to
+// discover more. Polling goes on with the previous ones in case of error.
+func reloadConfig() ([]*target, func(map[string]*target) ([]*target, error), error) {
+	if err := loadConfig(*configFile); err != nil {
+		return nil, nil, err
+	}
+	if err := setupLogging(); err != nil {
+		return nil, nil, err
+	}
+	setMemoryLimit()
+	return setupTargets()
+}
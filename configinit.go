@@ -0,0 +1,181 @@
+/*
+ * configinit.go - starter configuration file generated from a live server
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Handle the "config init" subcommand: probe the server given with -server
+// for its cores and the collectors returning values on it, and write a
+// commented configuration file to -config, or to stdout. The server is
+// reached with the same parameters as when polling it, from the command line
+// or the environment.
+func configCommand(args []string) error {
+	if len(args) == 0 || args[0] != "init" {
+		return fmt.Errorf("usage: solr-status config init -server host:port [-https] [-config file]")
+	}
+	if err := flag.CommandLine.Parse(args[1:]); err != nil {
+		return err
+	}
+	if err := loadEnv(); err != nil {
+		return err
+	}
+	format := "yaml"
+	if *configFile != "" {
+		var err error
+		if format, err = configFormat(*configFile); err != nil {
+			return err
+		}
+		if _, err := os.Stat(*configFile); err == nil {
+			return fmt.Errorf("%s already exists", *configFile)
+		}
+	}
+
+	targets, discover, err := setupTargets()
+	if err != nil {
+		return err
+	}
+	if len(targets) != 1 || discover != nil {
+		return fmt.Errorf("config init requires a single -server")
+	}
+	t := targets[0]
+	cores, err := discoverCores(t)
+	if err != nil {
+		return err
+	}
+	text := starterConfig(t, cores, format)
+
+	if *configFile == "" {
+		fmt.Print(text)
+		return nil
+	}
+	if err := ioutil.WriteFile(*configFile, []byte(text), 0644); err != nil {
+		return fmt.Errorf("cannot write config file: %v", err)
+	}
+	fmt.Printf("%s written\n", *configFile)
+	return nil
+}
+
+// Return the format of a configuration file from its extension, "yaml" or
+// "toml", as loadConfig reads it.
+func configFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		return "toml", nil
+	case ".yaml", ".yml":
+		return "yaml", nil
+	}
+	return "", fmt.Errorf("unknown config file format '%s': expected .yaml, .yml or .toml", filepath.Ext(path))
+}
+
+// Return the configuration file for the target and its cores, in the format.
+// Every collector is tried, on each core until it returns values for core
+// ones, and the ones which never do are left commented out, as are the heavy
+// ones.
+func starterConfig(t *target, cores []string, format string) string {
+	var b strings.Builder
+	set := func(key, value string) string {
+		if format == "toml" {
+			return key + " = " + value
+		}
+		return key + ": " + value
+	}
+
+	fmt.Fprintf(&b, "# solr-status configuration, generated by \"solr-status config init\" from\n")
+	fmt.Fprintf(&b, "# %s on %s. Every key is the name of a parameter.\n\n", t.server, time.Now().Format("2006-01-02"))
+	fmt.Fprintf(&b, "%s\n", set("server", configList([]string{t.server})))
+	if *useHTTPS {
+		fmt.Fprintf(&b, "%s\n", set("https", "true"))
+	}
+
+	fmt.Fprintf(&b, "\n# The cores found on the server. Remove this key to monitor every core,\n")
+	fmt.Fprintf(&b, "# including the ones created later.\n")
+	if len(cores) == 0 {
+		fmt.Fprintf(&b, "# %s\n", set("core", "[]"))
+	} else {
+		fmt.Fprintf(&b, "%s\n", set("core", configList(cores)))
+	}
+
+	if _, err := getClusterStatus(t); err == nil {
+		fmt.Fprintf(&b, "\n# The server is part of a SolrCloud cluster: poll all its live nodes.\n")
+		fmt.Fprintf(&b, "# %s\n", set("cluster", "true"))
+	}
+
+	fmt.Fprintf(&b, "\n# The collectors which returned values. The ones commented out did not,\n")
+	fmt.Fprintf(&b, "# e.g. because the feature is not enabled in Solr or needs more parameters,\n")
+	fmt.Fprintf(&b, "# or are heavy and are better given a collector-interval.\n")
+	available := make(map[string]bool)
+	enabled := false
+	for _, c := range coreCollectors {
+		for _, core := range cores {
+			if available[c.name] = collectorAvailable(t, c, core); available[c.name] {
+				break
+			}
+		}
+		enabled = enabled || available[c.name] && !c.heavy
+	}
+	for _, c := range nodeCollectors {
+		available[c.name] = len(cores) > 0 && collectorAvailable(t, c, cores[0])
+		enabled = enabled || available[c.name] && !c.heavy
+	}
+
+	// YAML reads a key followed by comments only as null, not as an empty list.
+	switch {
+	case format == "toml":
+		fmt.Fprintf(&b, "collectors = [\n")
+	case enabled:
+		fmt.Fprintf(&b, "collectors:\n")
+	default:
+		fmt.Fprintf(&b, "collectors: []\n")
+	}
+	for _, c := range append(append([]collector(nil), coreCollectors...), nodeCollectors...) {
+		writeCollector(&b, c, available[c.name], format)
+	}
+	if format == "toml" {
+		fmt.Fprintf(&b, "]\n")
+	}
+	return b.String()
+}
+
+// Return a list of strings, quoted so that both YAML and TOML read it, e.g.
+// the IPv6 server "[::1]:8983".
+func configList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = strconv.Quote(v)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// Return whether the collector returns values for the core.
+func collectorAvailable(t *target, c collector, core string) bool {
+	v, err := c.collect(t, core)
+	return err == nil && len(v) > 0
+}
+
+// Write a collector to the list of the configuration file.
+func writeCollector(b *strings.Builder, c collector, available bool, format string) {
+	item := "- " + c.name
+	if format == "toml" {
+		item = strconv.Quote(c.name) + ","
+	}
+	switch {
+	case !available:
+		fmt.Fprintf(b, "  # %s\n", item)
+	case c.heavy:
+		fmt.Fprintf(b, "  # %s (heavy)\n", item)
+	default:
+		fmt.Fprintf(b, "  %s\n", item)
+	}
+}
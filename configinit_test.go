@@ -0,0 +1,131 @@
+/*
+ * configinit_test.go - tests of the starter configuration file
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+func TestConfigFormat(t *testing.T) {
+	tests := []struct {
+		path, format string
+		valid        bool
+	}{
+		{"/etc/solr-status.yaml", "yaml", true},
+		{"/etc/solr-status.YML", "yaml", true},
+		{"/etc/solr-status.toml", "toml", true},
+		{"/etc/solr-status.json", "", false},
+		{"/etc/solr-status", "", false},
+	}
+	for _, test := range tests {
+		format, err := configFormat(test.path)
+		if format != test.format || (err == nil) != test.valid {
+			t.Errorf("configFormat(%s) = %s, %v, expected %s", test.path, format, err, test.format)
+		}
+	}
+}
+
+func TestStarterConfig(t *testing.T) {
+	target := newTestTarget(t, nil)
+	cores := []string{"products", "orders"}
+
+	for _, format := range []string{"yaml", "toml"} {
+		text := starterConfig(target, cores, format)
+		config := make(map[string]interface{})
+		var err error
+		if format == "toml" {
+			err = toml.Unmarshal([]byte(text), &config)
+		} else {
+			err = yaml.Unmarshal([]byte(text), &config)
+		}
+		if err != nil {
+			t.Fatalf("cannot parse the %s configuration: %v\n%s", format, err, text)
+		}
+		if servers := configValues(config["server"]); !reflect.DeepEqual(servers, []string{target.server}) {
+			t.Errorf("%s server = %v, expected [%s]", format, servers, target.server)
+		}
+		if got := configValues(config["core"]); !reflect.DeepEqual(got, cores) {
+			t.Errorf("%s core = %v, expected %v", format, got, cores)
+		}
+	}
+}
+
+func TestConfigList(t *testing.T) {
+	servers := []string{"[::1]:8983", "solr1.example.com:8983"}
+	for _, format := range []string{"yaml", "toml"} {
+		text := "server: " + configList(servers)
+		config := make(map[string]interface{})
+		var err error
+		if format == "toml" {
+			text = "server = " + configList(servers)
+			err = toml.Unmarshal([]byte(text), &config)
+		} else {
+			err = yaml.Unmarshal([]byte(text), &config)
+		}
+		if err != nil {
+			t.Fatalf("cannot parse %s: %v", text, err)
+		}
+		if got := configValues(config["server"]); !reflect.DeepEqual(got, servers) {
+			t.Errorf("%s = %v, expected %v", text, got, servers)
+		}
+	}
+}
+
+func TestStarterConfigLoads(t *testing.T) {
+	// Loading a file sets every parameter the command line does not give:
+	// an empty one puts the defaults back.
+	empty := filepath.Join(t.TempDir(), "empty.yaml")
+	if err := ioutil.WriteFile(empty, []byte("{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer loadConfig(empty)
+
+	noCollector := newTestTarget(t, nil)
+	jvm := newTestTarget(t, map[string]string{"/admin/metrics": `{"metrics": {"solr.jvm": {"memory.heap.used": 100}}}`})
+	tests := []struct {
+		target     *target
+		cores      []string
+		collectors []string
+	}{
+		{noCollector, nil, nil},
+		{noCollector, []string{"products"}, nil},
+		{jvm, []string{"products"}, []string{"jvm"}},
+	}
+	for _, test := range tests {
+		for _, format := range []string{"yaml", "toml"} {
+			path := filepath.Join(t.TempDir(), "solr-status."+format)
+			text := starterConfig(test.target, test.cores, format)
+			if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := loadConfig(path); err != nil {
+				t.Errorf("cannot load the %s configuration of %v: %v\n%s", format, test.cores, err, text)
+				continue
+			}
+			if !reflect.DeepEqual([]string(serverNames), []string{test.target.server}) {
+				t.Errorf("%s configuration of %v: server = %v, expected [%s]", format, test.cores, serverNames, test.target.server)
+			}
+			if !reflect.DeepEqual([]string(coreNames), test.cores) {
+				t.Errorf("%s configuration of %v: core = %v, expected %v", format, test.cores, coreNames, test.cores)
+			}
+			var enabled []string
+			for _, c := range append(append([]collector(nil), coreCollectors...), nodeCollectors...) {
+				if *c.enabled {
+					enabled = append(enabled, c.name)
+				}
+			}
+			if !reflect.DeepEqual(enabled, test.collectors) {
+				t.Errorf("%s configuration of %v: collectors = %v, expected %v", format, test.cores, enabled, test.collectors)
+			}
+		}
+	}
+}
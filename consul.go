@@ -0,0 +1,100 @@
+/*
+ * consul.go - discovery of Solr servers through the Consul catalog
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Jeffail/gabs"
+)
+
+var (
+	consulService = flag.String("consul-service", "", "discover the solr servers from the healthy instances of this Consul service")
+	consulTag     = flag.String("consul-tag", "", "only use the Consul service instances with this tag")
+	consulAddr    = flag.String("consul-addr", "", "address of the Consul agent (defaults to $CONSUL_HTTP_ADDR, or 127.0.0.1:8500)")
+)
+
+// Return one target per healthy instance of the Consul service, reported
+// under the name of the Consul node hosting it. The catalog is read on every
+// cycle, so that instances registering or deregistering are followed.
+func discoverConsulTargets(known map[string]*target) ([]*target, error) {
+	addr := *consulAddr
+	if addr == "" {
+		addr = os.Getenv("CONSUL_HTTP_ADDR")
+	}
+	if addr == "" {
+		addr = "127.0.0.1:8500"
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+
+	params := url.Values{"passing": {"true"}}
+	if *consulTag != "" {
+		params.Set("tag", *consulTag)
+	}
+	req, err := http.NewRequestWithContext(cycleContext, "GET", fmt.Sprintf("%s/v1/health/service/%s?%s",
+		strings.TrimRight(addr, "/"), url.PathEscape(*consulService), params.Encode()), nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query Consul: %v", err)
+	}
+	if token := os.Getenv("CONSUL_HTTP_TOKEN"); token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+
+	client := &http.Client{Timeout: httpTimeout()}
+	r, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query Consul: %v", err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot query Consul: got status code %d, expected 200", r.StatusCode)
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read Consul reply: %v", err)
+	}
+	data, err := gabs.ParseJSON(body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse Consul reply: %v", err)
+	}
+
+	var servers []string
+	nodes := make(map[string]string)
+	for _, entry := range data.Children() {
+		// The service address defaults to the one of its node.
+		host, _ := entry.Path("Service.Address").Data().(string)
+		if host == "" {
+			host, _ = entry.Path("Node.Address").Data().(string)
+		}
+		port, _ := entry.Path("Service.Port").Data().(float64)
+		if host == "" || port == 0 {
+			continue
+		}
+		server := net.JoinHostPort(host, strconv.Itoa(int(port)))
+		servers = append(servers, server)
+		nodes[server], _ = entry.Path("Node.Node").Data().(string)
+	}
+
+	targets := syncTargets(known, servers)
+	if len(targets) > 1 {
+		for _, t := range targets {
+			if nodes[t.server] != "" {
+				t.host = nodes[t.server]
+			}
+		}
+	}
+	return targets, nil
+}
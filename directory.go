@@ -0,0 +1,63 @@
+/*
+ * directory.go - directory factory and NRT caching metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var directoryStats = flag.Bool("directory-stats", false, "collect NRTCachingDirectory, HDFS block cache and directory I/O stats, when available")
+
+// NRTCachingDirectory settings, as shown in the CoreAdmin STATUS "directory" string.
+var nrtCachingSettings = regexp.MustCompile(`(maxCacheMB|maxMergeSizeMB)=([0-9.]+)`)
+
+// Collect the directory stats of the specified core, skipping whatever its
+// directory factory does not provide. Solr does not expose how many bytes an
+// NRTCachingDirectory currently holds, only its limits.
+func getDirectoryValues(t *target, core string) ([]Value, error) {
+	var values []Value
+
+	data, err := getParsedJson(fmt.Sprintf("%s/admin/cores?action=STATUS&core=%s&wt=json",
+		t.baseURL(),
+		url.QueryEscape(core)))
+	if err != nil {
+		return nil, err
+	}
+	if directory, ok := data.S("status", core, "index", "directory").Data().(string); ok &&
+		strings.Contains(directory, "NRTCachingDirectory") {
+		for _, m := range nrtCachingSettings.FindAllStringSubmatch(directory, -1) {
+			mb, err := strconv.ParseFloat(m[2], 64)
+			if err != nil {
+				continue
+			}
+			values = append(values, Value{Type: "gauge", Name: "directory_nrt_" + strings.ToLower(m[1][:len(m[1])-2]),
+				Value: float64(int64(mb * (1 << 20)))})
+		}
+	}
+
+	// HDFS block cache, and directory I/O when directoryDetails is enabled.
+	registry, err := getCoreMetrics(t, core, "CACHE.hdfsBlockCache", "DIRECTORY.total.")
+	if err != nil {
+		return values, err
+	}
+	values = append(values, cacheValues(registry.S("CACHE.hdfsBlockCache"), "blockCache")...)
+	for _, key := range sortedKeys(registry) {
+		if !strings.HasPrefix(key, "DIRECTORY.total.") {
+			continue
+		}
+		if v, ok := metricCount(registry.S(key)); ok {
+			values = append(values, Value{Type: "derive",
+				Name: "directory_" + metricName(strings.ToLower(strings.TrimPrefix(key, "DIRECTORY.total."))), Value: v})
+		}
+	}
+
+	return values, nil
+}
@@ -0,0 +1,38 @@
+/*
+ * directory_test.go - tests of the directory metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDirectoryCoreEscaped(t *testing.T) {
+	const core = "a&b c#d"
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/admin/metrics") {
+			w.Write([]byte(`{"metrics": {"solr.core.x": {"CORE.coreName": "a&b c#d"}}}`))
+			return
+		}
+		got = r.URL.Query().Get("core")
+		w.Write([]byte(`{"status": {"a&b c#d": {"index": {"directory": "NRTCachingDirectory(maxCacheMB=48.0 maxMergeSizeMB=4.0)"}}}}`))
+	}))
+	defer server.Close()
+
+	values, err := getDirectoryValues(newTarget(strings.TrimPrefix(server.URL, "http://")), core)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != core {
+		t.Errorf("core sent as %q, expected %q", got, core)
+	}
+	if len(values) == 0 {
+		t.Errorf("no directory values for %q", core)
+	}
+}
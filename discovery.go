@@ -0,0 +1,188 @@
+/*
+ * discovery.go - discovery of the servers and cores to monitor
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+)
+
+var (
+	clusterMode       = flag.Bool("cluster", false, "poll every live node of the SolrCloud cluster -server belongs to, and report cluster totals")
+	coreInclude       = flag.String("core-include", "", "only monitor the discovered cores whose name matches this regex")
+	coreExclude       = flag.String("core-exclude", "", "do not monitor the discovered cores whose name matches this regex")
+	discoveryInterval = flag.Duration("discovery-interval", 5*time.Minute, "how often cores are discovered again when -core is omitted")
+	srvRecord         = flag.String("srv", "", "discover the solr servers from this DNS SRV record, e.g. \"_solr._tcp.example.com\"")
+	srvInterval       = flag.Duration("srv-interval", time.Minute, "how often the DNS SRV record is resolved again")
+)
+
+// The servers last resolved from the SRV record, and when.
+var (
+	srvServers  []string
+	srvResolved time.Time
+)
+
+// The compiled -core-include and -core-exclude regexes, nil when not set.
+var coreIncludeRe, coreExcludeRe *regexp.Regexp
+
+// Session used to discover the live Solr nodes from ZooKeeper.
+var (
+	zkConn   *zk.Conn
+	zkEvents <-chan zk.Event
+)
+
+// Return how to discover the servers to poll, or nil if they are only the
+// ones given with -server and -targets.
+func serverDiscovery(static []*target) func(known map[string]*target) ([]*target, error) {
+	switch {
+	case *consulService != "":
+		return discoverConsulTargets
+	case *srvRecord != "":
+		return discoverSRVTargets
+	case *k8sSelector != "":
+		return discoverK8sTargets
+	case *zkHost != "" && len(static) == 0:
+		return discoverZKTargets
+	}
+	return nil
+}
+
+// Compile the core filters, if any.
+func compileCoreFilters() error {
+	var err error
+	coreIncludeRe, coreExcludeRe = nil, nil
+	if *coreInclude != "" {
+		if coreIncludeRe, err = regexp.Compile(*coreInclude); err != nil {
+			return fmt.Errorf("invalid core include regex: %v", err)
+		}
+	}
+	if *coreExclude != "" {
+		if coreExcludeRe, err = regexp.Compile(*coreExclude); err != nil {
+			return fmt.Errorf("invalid core exclude regex: %v", err)
+		}
+	}
+	return nil
+}
+
+// Return the cores of the target to monitor when -core is omitted. They are
+// discovered again every -discovery-interval, or as soon as one of them went
+// missing. Should discovery fail, the last cores found are returned.
+func (t *target) discoveredCores() []string {
+	if t.discoveredAt.IsZero() || t.coreMissing || time.Since(t.discoveredAt) >= *discoveryInterval {
+		cores, err := discoverCores(t)
+		if err != nil {
+			warnf("%v", err)
+			return t.discovered
+		}
+		t.discovered, t.discoveredAt, t.coreMissing = cores, time.Now(), false
+	}
+	return t.discovered
+}
+
+// Return the names of every core loaded by the server that passes the core filters.
+func discoverCores(t *target) ([]string, error) {
+	data, err := getParsedJson(t.baseURL() + "/admin/cores?action=STATUS&indexInfo=false&wt=json")
+	if err != nil {
+		return nil, fmt.Errorf("cannot discover cores: %v", err)
+	}
+
+	var cores []string
+	for name := range data.S("status").ChildrenMap() {
+		if coreIncludeRe != nil && !coreIncludeRe.MatchString(name) {
+			continue
+		}
+		if coreExcludeRe != nil && coreExcludeRe.MatchString(name) {
+			continue
+		}
+		cores = append(cores, name)
+	}
+	sort.Strings(cores)
+	return cores, nil
+}
+
+// Return one target per live Solr node registered in ZooKeeper, so that nodes
+// joining or leaving the cluster are picked up on the next cycle.
+func discoverZKTargets(known map[string]*target) ([]*target, error) {
+	if zkConn == nil {
+		conn, events, err := zk.Connect(zkAddresses(*zkHost), httpTimeout(), zk.WithLogInfo(false))
+		if err != nil {
+			return nil, fmt.Errorf("cannot connect to ZooKeeper: %v", err)
+		}
+		zkConn, zkEvents = conn, events
+	}
+
+	// The client reconnects by itself, but requests would hang until it does.
+	timeout := time.After(httpTimeout())
+	for zkConn.State() != zk.StateHasSession {
+		select {
+		case <-zkEvents:
+		case <-timeout:
+			return nil, fmt.Errorf("cannot discover live nodes: no ZooKeeper session")
+		}
+	}
+
+	nodes, _, err := zkConn.Children(zkChroot(*zkHost) + "/live_nodes")
+	if err != nil {
+		return nil, fmt.Errorf("cannot discover live nodes: %v", err)
+	}
+	return syncTargets(known, nodeServers(nodes)), nil
+}
+
+// Return one target per server the SRV record points to. The record is only
+// resolved again every -srv-interval, and its last answer used in between.
+func discoverSRVTargets(known map[string]*target) ([]*target, error) {
+	if srvServers == nil || time.Since(srvResolved) >= *srvInterval {
+		_, records, err := net.LookupSRV("", "", *srvRecord)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve SRV record: %v", err)
+		}
+
+		var servers []string
+		for _, r := range records {
+			servers = append(servers, net.JoinHostPort(strings.TrimSuffix(r.Target, "."), strconv.Itoa(int(r.Port))))
+		}
+		srvServers, srvResolved = servers, time.Now()
+	}
+	return syncTargets(known, srvServers), nil
+}
+
+// Return one target per live node of the cluster, as listed by the first of
+// the seeds answering CLUSTERSTATUS.
+func discoverClusterTargets(seeds []*target, known map[string]*target) ([]*target, error) {
+	_, cluster, err := firstAnswering(seeds, getClusterStatus)
+	if err != nil {
+		return nil, fmt.Errorf("cannot discover cluster nodes: %v", err)
+	}
+
+	var nodes []string
+	for _, node := range cluster.S("live_nodes").Children() {
+		if name, ok := node.Data().(string); ok {
+			nodes = append(nodes, name)
+		}
+	}
+	return syncTargets(known, nodeServers(nodes)), nil
+}
+
+// Return the addresses of SolrCloud nodes, which are named after their
+// address and context, e.g. "10.0.0.1:8983_solr".
+func nodeServers(nodes []string) []string {
+	var servers []string
+	for _, node := range nodes {
+		if i := strings.LastIndex(node, "_"); i > 0 {
+			node = node[:i]
+		}
+		servers = append(servers, node)
+	}
+	return servers
+}
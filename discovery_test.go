@@ -0,0 +1,33 @@
+/*
+ * discovery_test.go - tests of the discovery of the servers to poll
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiscoverClusterTargets(t *testing.T) {
+	down := newTestTarget(t, nil)
+	seed := newTestTarget(t, map[string]string{"/admin/collections": `{"cluster": {"live_nodes": ["10.0.0.1:8983_solr", "10.0.0.2:8983_solr"]}}`})
+
+	targets, err := discoverClusterTargets([]*target{down, seed}, make(map[string]*target))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var servers []string
+	for _, target := range targets {
+		servers = append(servers, target.server)
+	}
+	if expected := []string{"10.0.0.1:8983", "10.0.0.2:8983"}; !reflect.DeepEqual(servers, expected) {
+		t.Errorf("discoverClusterTargets() = %v, expected %v", servers, expected)
+	}
+
+	if _, err := discoverClusterTargets([]*target{down}, make(map[string]*target)); err == nil || !strings.HasPrefix(err.Error(), "cannot discover cluster nodes: ") {
+		t.Errorf("discoverClusterTargets() without an answering seed: %v", err)
+	}
+}
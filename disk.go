@@ -0,0 +1,44 @@
+/*
+ * disk.go - data directory disk space metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import "flag"
+
+var diskStats = flag.Bool("disk-stats", false, "collect usable and total disk space of the core's data directory")
+
+// Collect the disk space of the filesystem holding the specified core's data
+// directory. Falls back to the node-wide CONTAINER.fs metrics (the Solr home)
+// when the core-level ones are missing.
+func getDiskValues(t *target, core string) ([]Value, error) {
+	registry, err := getCoreMetrics(t, core, "CORE.fs.")
+	if err != nil {
+		return nil, err
+	}
+	usable, okUsable := registry.S("CORE.fs.usableSpace").Data().(float64)
+	total, okTotal := registry.S("CORE.fs.totalSpace").Data().(float64)
+
+	if !okUsable || !okTotal {
+		registries, err := getMetrics(t, "node", "CONTAINER.fs.")
+		if err != nil {
+			return nil, err
+		}
+		node := registries.S("solr.node")
+		usable, okUsable = node.S("CONTAINER.fs.usableSpace").Data().(float64)
+		total, okTotal = node.S("CONTAINER.fs.totalSpace").Data().(float64)
+		if !okUsable || !okTotal {
+			return nil, nil
+		}
+	}
+
+	values := []Value{
+		{Type: "gauge", Name: "disk_usable", Value: usable},
+		{Type: "gauge", Name: "disk_total", Value: total},
+	}
+	if total > 0 {
+		values = append(values, Value{Type: "gauge", Name: "disk_used_percent", Value: 100 * (total - usable) / total})
+	}
+	return values, nil
+}
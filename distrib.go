@@ -0,0 +1,68 @@
+/*
+ * distrib.go - distributed (cross-shard) query metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"strings"
+)
+
+const shardHandler = "QUERY.httpShardHandler."
+
+var distribStats = flag.Bool("distrib-stats", false, "collect distributed /select requests, errors and shard request latency (SolrCloud)")
+
+// Collect the stats of the distributed /select requests coordinated by the
+// specified core, along with the requests the node sent to other shards.
+func getDistribValues(t *target, core string) ([]Value, error) {
+	registry, err := getCoreMetrics(t, core, "QUERY./select.distrib.")
+	if err != nil {
+		return nil, err
+	}
+	values := handlerValues(registry, "QUERY./select.distrib", "distrib_select")
+
+	// Shard requests are timed per destination and method, sum them up.
+	registries, err := getMetrics(t, "node", shardHandler)
+	if err != nil {
+		return values, err
+	}
+	metrics := registries.S("solr.node")
+
+	var requests, errors, totalTime float64
+	var found, hasErrors bool
+	for _, key := range sortedKeys(metrics) {
+		if strings.HasSuffix(key, ".errors") {
+			if v, ok := metricCount(metrics.S(key)); ok {
+				errors += v
+				hasErrors = true
+			}
+			continue
+		}
+		if !strings.HasSuffix(key, ".requests") {
+			continue
+		}
+		timer := metrics.S(key)
+		count, ok := metricCount(timer)
+		if !ok {
+			continue
+		}
+		found = true
+		requests += count
+		if mean, ok := timer.S("mean_ms").Data().(float64); ok {
+			totalTime += mean * count
+		}
+	}
+
+	if found {
+		values = append(values, Value{Type: "derive", Name: "shard_requests", Value: requests})
+		if requests > 0 {
+			values = append(values, Value{Type: "gauge", Name: "shard_requesttime_mean", Value: totalTime / requests})
+		}
+	}
+	if hasErrors {
+		values = append(values, Value{Type: "derive", Name: "shard_errors", Value: errors})
+	}
+	return values, nil
+}
@@ -0,0 +1,49 @@
+/*
+ * dryrun.go - check the configuration and what would be collected, then exit
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var dryRun = flag.Bool("dry-run", false, "check the configuration, the servers and the cores, print what would be collected and emitted instead of writing it, and exit")
+
+// Print the collectors enabled, and whether every core of the targets could
+// be collected on the dry run cycle.
+func printDryRun(targets []*target) {
+	var enabled []string
+	for _, list := range [][]collector{coreCollectors, nodeCollectors} {
+		for _, c := range list {
+			if *c.enabled {
+				enabled = append(enabled, c.name)
+			}
+		}
+	}
+	if len(enabled) == 0 {
+		enabled = []string{"none"}
+	}
+	fmt.Printf("collectors: %s\n", strings.Join(enabled, ", "))
+
+	for _, t := range targets {
+		host := t.host
+		if host == "" {
+			host = "the local host name"
+		}
+		fmt.Printf("server %s, reported under %s\n", t.server, host)
+		if len(t.polled) == 0 {
+			fmt.Println("  no core found")
+		}
+		for _, core := range t.polled {
+			state := "ok"
+			if t.statuses[core] == nil {
+				state = "FAILED, see the errors above"
+			}
+			fmt.Printf("  core %s: %s\n", core, state)
+		}
+	}
+}
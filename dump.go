@@ -0,0 +1,81 @@
+/*
+ * dump.go - raw API replies written to disk, to debug parsing
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	debugDumpDir    = flag.String("debug-dump-dir", "", "write the raw reply of every Solr API call to this directory, one subdirectory per cycle")
+	debugDumpCycles = flag.Int("debug-dump-cycles", 10, "how many cycles of raw replies are kept in -debug-dump-dir")
+)
+
+// Directory of the replies of the current cycle, empty when not dumping.
+var dumpCycleDir string
+
+// How many replies were dumped during the current cycle.
+var dumpCount int64
+
+var dumpNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Start dumping the replies of a new cycle, and remove the oldest cycles.
+// It must be called before the cycle's requests are made.
+func startDumpCycle(now time.Time) {
+	dumpCycleDir = ""
+	atomic.StoreInt64(&dumpCount, 0)
+	if *debugDumpDir == "" {
+		return
+	}
+
+	// Cycles may run several times a second, see -interval.
+	dir := filepath.Join(*debugDumpDir, now.Format("20060102-150405.000"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		warnf("cannot create dump directory: %v", err)
+		return
+	}
+	dumpCycleDir = dir
+
+	// Cycle directories sort by date.
+	matches, _ := filepath.Glob(filepath.Join(*debugDumpDir, "[0-9]*-[0-9]*"))
+	sort.Strings(matches)
+	for len(matches) > *debugDumpCycles && *debugDumpCycles > 0 {
+		os.RemoveAll(matches[0])
+		matches = matches[1:]
+	}
+}
+
+// Write the raw reply of a URL to the directory of the current cycle, in a
+// file named after the order of the call and the URL.
+func dumpReply(url string, body []byte) {
+	if dumpCycleDir == "" {
+		return
+	}
+
+	name := url
+	if i := strings.Index(name, "://"); i >= 0 {
+		name = name[i+3:]
+	}
+	name = dumpNameChars.ReplaceAllString(name, "_")
+	if len(name) > 200 {
+		name = name[:200]
+	}
+	n := atomic.AddInt64(&dumpCount, 1)
+
+	path := filepath.Join(dumpCycleDir, fmt.Sprintf("%03d-%s.json", n, name))
+	if err := ioutil.WriteFile(path, body, 0644); err != nil {
+		warnf("cannot dump reply: %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+/*
+ * dump_test.go - tests of the raw API replies written to disk
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDumpCyclesPruned(t *testing.T) {
+	defer func(dir string, cycles int) {
+		*debugDumpDir, *debugDumpCycles, dumpCycleDir = dir, cycles, ""
+	}(*debugDumpDir, *debugDumpCycles)
+	*debugDumpDir = t.TempDir()
+	*debugDumpCycles = 2
+
+	start := time.Date(2020, 3, 3, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		startDumpCycle(start.Add(time.Duration(i) * 250 * time.Millisecond))
+	}
+
+	entries, err := ioutil.ReadDir(*debugDumpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if expected := []string{"20200303-100000.750", "20200303-100001.000"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("dump directories %v, expected %v", names, expected)
+	}
+}
@@ -0,0 +1,46 @@
+/*
+ * filter.go - filtering of the values written
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+)
+
+var (
+	metricInclude = flag.String("metric-include", "", "only write the values whose identifier matches this regex, e.g. \"gauge-(numdocs|jvm_heap_used)$\"")
+	metricExclude = flag.String("metric-exclude", "", "do not write the values whose identifier matches this regex")
+)
+
+// The compiled -metric-include and -metric-exclude regexes, nil when not set.
+var metricIncludeRe, metricExcludeRe *regexp.Regexp
+
+// Compile the metric filters, if any.
+func compileMetricFilters() error {
+	var err error
+	metricIncludeRe, metricExcludeRe = nil, nil
+	if *metricInclude != "" {
+		if metricIncludeRe, err = regexp.Compile(*metricInclude); err != nil {
+			return fmt.Errorf("invalid metric include regex: %v", err)
+		}
+	}
+	if *metricExclude != "" {
+		if metricExcludeRe, err = regexp.Compile(*metricExclude); err != nil {
+			return fmt.Errorf("invalid metric exclude regex: %v", err)
+		}
+	}
+	return nil
+}
+
+// Return whether a value passes the metric filters. They are matched against
+// its identifier without the host, e.g. "solr_status-jvm/gauge-jvm_heap_used".
+func metricAllowed(id string) bool {
+	if metricIncludeRe != nil && !metricIncludeRe.MatchString(id) {
+		return false
+	}
+	return metricExcludeRe == nil || !metricExcludeRe.MatchString(id)
+}
@@ -0,0 +1,110 @@
+/*
+ * forcemerge.go - detection of running optimize/forceMerge operations
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/Jeffail/gabs"
+)
+
+// How many consecutive cycles the segment count must shrink, while merge
+// threads are running, to assume a forceMerge is in progress.
+const forceMergeTrajectory = 3
+
+// Recent segment counts per core, oldest first, keyed by server and core.
+var (
+	segmentTrajectoryLock sync.Mutex
+	segmentTrajectory     = make(map[string][]int)
+)
+
+// Count the threads of the dump currently inside IndexWriter.forceMerge,
+// which is what both optimize and forceMerge requests end up calling, and
+// among them the ones whose name tells they work on the core. As the dump
+// is node-wide, the others may work on any core of the node.
+func forceMergeThreads(dump *gabs.Container, core string) (all, own int) {
+	for _, child := range dump.Children() {
+		for _, frame := range child.S("stackTrace").Children() {
+			if s, ok := frame.Data().(string); ok && strings.Contains(s, "IndexWriter.forceMerge") {
+				all++
+				if name, ok := child.S("name").Data().(string); ok && threadOfCore(name, core) {
+					own++
+				}
+				break
+			}
+		}
+	}
+	return all, own
+}
+
+// Tell whether a thread name mentions the core as a word of its own, e.g.
+// "qtp1-42 products optimize" for core "products" but not "products_v2".
+func threadOfCore(name, core string) bool {
+	for i := strings.Index(name, core); i >= 0; {
+		end := i + len(core)
+		if (i == 0 || !coreNameChar(name[i-1])) && (end == len(name) || !coreNameChar(name[end])) {
+			return true
+		}
+		next := strings.Index(name[i+1:], core)
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return false
+}
+
+// Tell whether a character may be part of a core name.
+func coreNameChar(c byte) bool {
+	return c == '_' || c == '-' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// Decide whether a forceMerge is running on the specified core: either a
+// thread working on the core was caught calling it, or merges have kept
+// shrinking the number of segments of the core over the last few cycles.
+func detectForceMerge(core string, status *SolrStatus, inDump bool) bool {
+	segmentTrajectoryLock.Lock()
+	defer segmentTrajectoryLock.Unlock()
+
+	trajectory := append(segmentTrajectory[core], status.SegmentCount)
+	if len(trajectory) > forceMergeTrajectory+1 {
+		trajectory = trajectory[1:]
+	}
+	segmentTrajectory[core] = trajectory
+
+	if inDump {
+		return true
+	}
+	if status.MergeThreadCount == 0 || len(trajectory) <= forceMergeTrajectory {
+		return false
+	}
+	for i := 1; i < len(trajectory); i++ {
+		if trajectory[i] >= trajectory[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// Forget the segment counts of the cores the targets no longer poll, such as
+// deleted cores or the replicas of a collection which moved to other nodes.
+func pruneSegmentTrajectories(targets []*target) {
+	polled := make(map[string]bool)
+	for _, t := range targets {
+		for _, core := range t.polled {
+			polled[t.server+"/"+core] = true
+		}
+	}
+
+	segmentTrajectoryLock.Lock()
+	defer segmentTrajectoryLock.Unlock()
+	for key := range segmentTrajectory {
+		if !polled[key] {
+			delete(segmentTrajectory, key)
+		}
+	}
+}
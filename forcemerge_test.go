@@ -0,0 +1,74 @@
+/*
+ * forcemerge_test.go - tests of the forceMerge detection
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/Jeffail/gabs"
+)
+
+func TestForceMergeThreads(t *testing.T) {
+	dump, err := gabs.ParseJSON([]byte(`[
+		{"name": "qtp1-42 products optimize", "stackTrace": ["org.apache.lucene.index.IndexWriter.forceMerge(IndexWriter.java:2050)", "org.apache.lucene.index.IndexWriter.forceMerge(IndexWriter.java:2000)"]},
+		{"name": "qtp1-43", "stackTrace": ["org.apache.lucene.index.IndexWriter.forceMerge(IndexWriter.java:2050)"]},
+		{"name": "qtp1-44 orders", "stackTrace": ["org.apache.solr.search.SolrIndexSearcher.search(SolrIndexSearcher.java:1)"]}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		core     string
+		all, own int
+	}{
+		{"products", 2, 1},
+		{"products_v2", 2, 0},
+		{"prod", 2, 0},
+		{"orders", 2, 0},
+	}
+	for _, test := range tests {
+		if all, own := forceMergeThreads(dump, test.core); all != test.all || own != test.own {
+			t.Errorf("forceMergeThreads(%s) = %d, %d, expected %d, %d", test.core, all, own, test.all, test.own)
+		}
+	}
+}
+
+func TestThreadOfCore(t *testing.T) {
+	tests := []struct {
+		name, core string
+		expected   bool
+	}{
+		{"products", "products", true},
+		{"qtp1-42 [products] optimize", "products", true},
+		{"commitScheduler products_shard1_replica_n1", "products_shard1_replica_n1", true},
+		{"qtp1-42 products_v2", "products", false},
+		{"qtp1-42 my-products", "products", false},
+		{"qtp1-42 products_v2 products", "products", true},
+		{"qtp1-42", "products", false},
+	}
+	for _, test := range tests {
+		if got := threadOfCore(test.name, test.core); got != test.expected {
+			t.Errorf("threadOfCore(%q, %q) = %v, expected %v", test.name, test.core, got, test.expected)
+		}
+	}
+}
+
+func TestPruneSegmentTrajectories(t *testing.T) {
+	defer func(trajectory map[string][]int) { segmentTrajectory = trajectory }(segmentTrajectory)
+	segmentTrajectory = map[string][]int{
+		"solr1:8983/products": {10, 9},
+		"solr1:8983/orders":   {5},
+		"solr2:8983/products": {7},
+	}
+	t1 := newTarget("solr1:8983")
+	t1.polled = []string{"products"}
+
+	pruneSegmentTrajectories([]*target{t1})
+	if len(segmentTrajectory) != 1 || segmentTrajectory["solr1:8983/products"] == nil {
+		t.Errorf("pruneSegmentTrajectories kept %v, expected solr1:8983/products only", segmentTrajectory)
+	}
+}
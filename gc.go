@@ -0,0 +1,44 @@
+/*
+ * gc.go - garbage collection metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"strings"
+)
+
+var gcStats = flag.Bool("gc-stats", false, "collect garbage collection counts and accumulated time per collector")
+
+// Collect the count and accumulated time (in ms) of every garbage collector.
+func getGCValues(t *target, core string) ([]Value, error) {
+	registries, err := getMetrics(t, "jvm", "gc.")
+	if err != nil {
+		return nil, err
+	}
+	registry := registries.S("solr.jvm")
+
+	var values []Value
+	for _, key := range sortedKeys(registry) {
+		// Keys look like "gc.G1-Young-Generation.count".
+		parts := strings.Split(key, ".")
+		if len(parts) != 3 || parts[0] != "gc" || (parts[2] != "count" && parts[2] != "time") {
+			continue
+		}
+		if v, ok := registry.S(key).Data().(float64); ok {
+			values = append(values, Value{
+				Type:  "derive",
+				Name:  "gc_" + gcName(parts[1]) + "_" + parts[2],
+				Value: v,
+			})
+		}
+	}
+	return values, nil
+}
+
+// Turn a garbage collector name (e.g. "G1-Young-Generation") into a metric name.
+func gcName(name string) string {
+	return strings.ToLower(strings.NewReplacer("-", "_", " ", "_").Replace(name))
+}
@@ -0,0 +1,99 @@
+/*
+ * handler.go - request handler performance metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/Jeffail/gabs"
+)
+
+var (
+	queryStats   = flag.Bool("query-stats", false, "collect request, error and latency stats of the /select handler")
+	handlerStats = flag.Bool("handler-stats", false, "collect request, error and latency stats of every handler listed in -handlers")
+	handlerPaths = flag.String("handlers", "/select,/query,/update,/get,/export", "comma-separated request handlers reported by -handler-stats")
+)
+
+// Metric categories request handlers can be registered under.
+var handlerCategories = []string{"QUERY", "UPDATE"}
+
+// Request time stats we report, keyed by their name in the metrics API.
+var requestTimeFields = []struct{ key, name string }{
+	{"mean_ms", "mean"},
+	{"median_ms", "median"},
+	{"p95_ms", "p95"},
+	{"p99_ms", "p99"},
+}
+
+// Collect the /select handler stats of the specified core.
+func getQueryValues(t *target, core string) ([]Value, error) {
+	registry, err := getCoreMetrics(t, core, "QUERY./select.")
+	if err != nil {
+		return nil, err
+	}
+	return handlerValues(registry, "QUERY./select", "select"), nil
+}
+
+// Collect the stats of every configured handler of the specified core, named
+// after the handler path (e.g. "handler_update_requests").
+func getHandlerValues(t *target, core string) ([]Value, error) {
+	var handlers, prefixes []string
+	for _, h := range strings.Split(*handlerPaths, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		handlers = append(handlers, h)
+		for _, category := range handlerCategories {
+			prefixes = append(prefixes, category+"."+h+".")
+		}
+	}
+
+	registry, err := getCoreMetrics(t, core, prefixes...)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []Value
+	for _, h := range handlers {
+		name := "handler_" + metricName(strings.ToLower(strings.Trim(h, "/")))
+		for _, category := range handlerCategories {
+			values = append(values, handlerValues(registry, category+"."+h, name)...)
+		}
+	}
+	return values, nil
+}
+
+// Return the request counters and latencies of a handler, named after the given prefix.
+func handlerValues(registry *gabs.Container, key, name string) []Value {
+	var values []Value
+
+	for _, counter := range []string{"requests", "errors", "timeouts"} {
+		if v, ok := metricCount(registry.S(key + "." + counter)); ok {
+			values = append(values, Value{Type: "derive", Name: name + "_" + counter, Value: v})
+		}
+	}
+
+	times := registry.S(key + ".requestTimes")
+	for _, f := range requestTimeFields {
+		if v, ok := times.S(f.key).Data().(float64); ok {
+			values = append(values, Value{Type: "gauge", Name: name + "_requesttime_" + f.name, Value: v})
+		}
+	}
+
+	return values
+}
+
+// Return the value of a counter, meter or timer. Compact replies render
+// counters as plain numbers, and the others as objects with a count.
+func metricCount(c *gabs.Container) (float64, bool) {
+	if v, ok := c.Data().(float64); ok {
+		return v, true
+	}
+	v, ok := c.S("count").Data().(float64)
+	return v, ok
+}
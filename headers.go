@@ -0,0 +1,98 @@
+/*
+ * headers.go - extra HTTP headers sent to the Solr servers
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Prefix of the headers among the labels of a server, e.g.
+// "header.X-API-Key=secret".
+const headerPrefix = "header."
+
+// Several HTTP headers, one per flag given, e.g. "X-API-Key: secret". Unlike
+// listFlag, values are not split on commas, which header values may contain.
+type headerFlag []string
+
+func (h *headerFlag) String() string {
+	return strings.Join(*h, "; ")
+}
+
+func (h *headerFlag) Set(s string) error {
+	*h = append(*h, s)
+	return nil
+}
+
+var headerSpecs headerFlag
+
+// Headers sent with every request, from -header, and the ones sent to some
+// servers only, by server.
+var (
+	globalHeaders http.Header
+	serverHeaders map[string]http.Header
+)
+
+func init() {
+	flag.Var(&headerSpecs, "header", "HTTP header sent with every request to Solr, e.g. \"X-API-Key: secret\" (repeated; headers of a single server follow it, e.g. -server \"solr1:8983 header.X-API-Key=secret\")")
+}
+
+// Parse the -header flags.
+func compileHeaders() error {
+	globalHeaders = make(http.Header)
+	serverHeaders = make(map[string]http.Header)
+	for _, spec := range headerSpecs {
+		parts := strings.SplitN(spec, ":", 2)
+		if len(parts) != 2 || !validHeaderName(strings.TrimSpace(parts[0])) {
+			return fmt.Errorf("invalid header '%s': expected \"Name: value\"", spec)
+		}
+		globalHeaders.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+	return nil
+}
+
+// Tell whether a header name is made of the characters allowed by HTTP.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune("\"(),/:;<=>?@[\\]{}", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// Remember the headers to send to a server.
+func setServerHeaders(server string, headers map[string]string) {
+	if len(headers) == 0 {
+		return
+	}
+	h := make(http.Header)
+	for name, v := range headers {
+		h.Set(name, v)
+	}
+	serverHeaders[server] = h
+}
+
+// Add the extra headers to a request: the -header ones, and the ones of the
+// server it is sent to. A Host header replaces the host of the URL.
+func addHeaders(req *http.Request) {
+	for _, h := range []http.Header{globalHeaders, serverHeaders[req.URL.Host]} {
+		for name, values := range h {
+			if http.CanonicalHeaderKey(name) == "Host" {
+				req.Host = values[0]
+				continue
+			}
+			for _, v := range values {
+				req.Header.Add(name, v)
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+/*
+ * headers_test.go - tests of the extra HTTP headers
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestCompileHeaders(t *testing.T) {
+	defer func(specs headerFlag, global http.Header, servers map[string]http.Header) {
+		headerSpecs, globalHeaders, serverHeaders = specs, global, servers
+	}(headerSpecs, globalHeaders, serverHeaders)
+
+	tests := []struct {
+		specs    headerFlag
+		expected http.Header // nil for an error
+	}{
+		{nil, http.Header{}},
+		{headerFlag{"X-API-Key: secret"}, http.Header{"X-Api-Key": {"secret"}}},
+		{headerFlag{"  X-API-Key:secret  "}, http.Header{"X-Api-Key": {"secret"}}},
+		{headerFlag{"Accept: a, b"}, http.Header{"Accept": {"a, b"}}},
+		{headerFlag{"X-Time: 10:30"}, http.Header{"X-Time": {"10:30"}}},
+		{headerFlag{"X-Tag: a", "X-Tag: b"}, http.Header{"X-Tag": {"a", "b"}}},
+		{headerFlag{"X-Empty:"}, http.Header{"X-Empty": {""}}},
+		{headerFlag{"X-API-Key secret"}, nil},
+		{headerFlag{": secret"}, nil},
+		{headerFlag{"X API Key: secret"}, nil},
+		{headerFlag{"X-Key(1): secret"}, nil},
+	}
+	for _, test := range tests {
+		headerSpecs = test.specs
+		err := compileHeaders()
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("compileHeaders(%v) = %v, expected an error", test.specs, globalHeaders)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(globalHeaders, test.expected) {
+			t.Errorf("compileHeaders(%v) = %v, %v, expected %v", test.specs, globalHeaders, err, test.expected)
+		}
+	}
+}
+
+func TestParseTargetSpecHeaders(t *testing.T) {
+	tests := []struct {
+		spec            string
+		server          string // empty for an error
+		labels, headers map[string]string
+	}{
+		{"gw.example.com:443 dc=eu header.X-API-Key=secret header.Host=solr1",
+			"gw.example.com:443", map[string]string{"dc": "eu"}, map[string]string{"X-API-Key": "secret", "Host": "solr1"}},
+		{"[::1]:8983 header.X-Token=a=b", "[::1]:8983", map[string]string{}, map[string]string{"X-Token": "a=b"}},
+		{"solr1:8983 header.X-API-Key", "", nil, nil},
+		{"solr1:8983 header.X(Key)=secret", "", nil, nil},
+	}
+	for _, test := range tests {
+		server, labels, headers, err := parseTargetSpec(test.spec)
+		if test.server == "" {
+			if err == nil {
+				t.Errorf("parseTargetSpec(%q) = %s, expected an error", test.spec, server)
+			}
+			continue
+		}
+		if err != nil || server != test.server || !reflect.DeepEqual(labels, test.labels) || !reflect.DeepEqual(headers, test.headers) {
+			t.Errorf("parseTargetSpec(%q) = %s, %v, %v, %v, expected %s, %v, %v",
+				test.spec, server, labels, headers, err, test.server, test.labels, test.headers)
+		}
+	}
+}
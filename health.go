@@ -0,0 +1,113 @@
+/*
+ * health.go - /healthz and /readyz endpoints to supervise the plugin
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	healthAddr   = flag.String("health-addr", "", "serve /healthz and /readyz on this address, e.g. \":8080\", or \"off\" not to in daemon mode")
+	healthCycles = flag.Int("health-cycles", 3, "how many of the last cycles /healthz and /readyz look at")
+)
+
+var (
+	healthMutex  sync.Mutex
+	cycleResults []bool // whether the last cycles succeeded, oldest first
+	lastCycleAt  = time.Now()
+)
+
+// Remember whether a cycle succeeded, forgetting the ones beyond -health-cycles.
+func recordHealth(ok bool) {
+	healthMutex.Lock()
+	defer healthMutex.Unlock()
+	cycleResults = append(cycleResults, ok)
+	if len(cycleResults) > *healthCycles {
+		cycleResults = cycleResults[len(cycleResults)-*healthCycles:]
+	}
+	lastCycleAt = time.Now()
+}
+
+// Listen on -health-addr, if set or in daemon mode, and serve the health
+// endpoints in the background.
+func startHealthServer() error {
+	addr := *healthAddr
+	if addr == "" && *mode == "daemon" {
+		addr = defaultDaemonHealthAddr
+	}
+	if addr == "" || addr == "off" {
+		return nil
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("cannot serve health endpoints: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		healthReply(w, healthy())
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		healthReply(w, ready())
+	})
+	go http.Serve(l, mux)
+	return nil
+}
+
+// Reply with 200 and "ok", or 503 and the reason why not.
+func healthReply(w http.ResponseWriter, problem string) {
+	if problem != "" {
+		http.Error(w, problem, http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// Tell why the plugin is not healthy: it has not completed a cycle for much
+// longer than expected, or every one of the last cycles failed.
+func healthy() string {
+	healthMutex.Lock()
+	defer healthMutex.Unlock()
+
+	cycle := pollInterval() + httpTimeout()
+	if since := time.Since(lastCycleAt); since > time.Duration(*healthCycles)*cycle {
+		return fmt.Sprintf("no cycle completed for %v", since.Round(time.Second))
+	}
+	if len(cycleResults) < *healthCycles {
+		return ""
+	}
+	for _, ok := range cycleResults {
+		if ok {
+			return ""
+		}
+	}
+	return fmt.Sprintf("the last %d cycles failed", len(cycleResults))
+}
+
+// Tell why the plugin is not ready: no cycle completed yet, or one of the last
+// cycles failed.
+func ready() string {
+	if problem := healthy(); problem != "" {
+		return problem
+	}
+
+	healthMutex.Lock()
+	defer healthMutex.Unlock()
+	if len(cycleResults) == 0 {
+		return "no cycle completed yet"
+	}
+	for _, ok := range cycleResults {
+		if !ok {
+			return fmt.Sprintf("one of the last %d cycles failed", len(cycleResults))
+		}
+	}
+	return ""
+}
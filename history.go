@@ -0,0 +1,74 @@
+/*
+ * history.go - in-memory history of past collection cycles
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// A single collection cycle for a core, as remembered by the history.
+type historyEntry struct {
+	Time   time.Time
+	Core   string
+	Status SolrStatus
+	Err    error
+}
+
+// An in-memory record of past collection cycles, bounded in time.
+type history struct {
+	sync.Mutex
+	retention time.Duration
+	entries   []historyEntry
+}
+
+func newHistory(retention time.Duration) *history {
+	return &history{retention: retention}
+}
+
+// Remember the outcome of a collection cycle and forget what is too old.
+func (h *history) record(core string, status *SolrStatus, err error) {
+	h.Lock()
+	defer h.Unlock()
+
+	now := time.Now()
+	entry := historyEntry{Time: now, Core: core, Err: err}
+	if err == nil {
+		entry.Status = *status
+	}
+	h.entries = append(h.entries, entry)
+
+	cutoff := now.Add(-h.retention)
+	i := 0
+	for i < len(h.entries) && h.entries[i].Time.Before(cutoff) {
+		i++
+	}
+	h.entries = h.entries[i:]
+}
+
+// Return a copy of the entries recorded after the given time.
+func (h *history) since(t time.Time) []historyEntry {
+	h.Lock()
+	defer h.Unlock()
+
+	var entries []historyEntry
+	for _, e := range h.entries {
+		if !e.Time.Before(t) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Forget the oldest half of the entries. Returns how many were dropped.
+func (h *history) shed() int {
+	h.Lock()
+	defer h.Unlock()
+
+	n := (len(h.entries) + 1) / 2
+	h.entries = append([]historyEntry(nil), h.entries[n:]...)
+	return n
+}
@@ -0,0 +1,41 @@
+/*
+ * jetty.go - Jetty container request metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import "flag"
+
+const jettyHandler = "org.eclipse.jetty.server.handler.DefaultHandler."
+
+var jettyStats = flag.Bool("jetty-stats", false, "collect container-level active requests, responses by status class and dispatch time")
+
+// Collect the request stats of the Jetty container, which also account for
+// requests that never reached a Solr handler.
+func getJettyValues(t *target, core string) ([]Value, error) {
+	registries, err := getMetrics(t, "jetty", jettyHandler)
+	if err != nil {
+		return nil, err
+	}
+	registry := registries.S("solr.jetty")
+
+	var values []Value
+	if v, ok := metricCount(registry.S(jettyHandler + "active-requests")); ok {
+		values = append(values, Value{Type: "gauge", Name: "jetty_active_requests", Value: v})
+	}
+	for _, class := range []string{"1xx", "2xx", "3xx", "4xx", "5xx"} {
+		if v, ok := metricCount(registry.S(jettyHandler + class + "-responses")); ok {
+			values = append(values, Value{Type: "derive", Name: "jetty_responses_" + class, Value: v})
+		}
+	}
+
+	dispatches := registry.S(jettyHandler + "dispatches")
+	for _, f := range requestTimeFields {
+		if v, ok := dispatches.S(f.key).Data().(float64); ok {
+			values = append(values, Value{Type: "gauge", Name: "jetty_dispatchtime_" + f.name, Value: v})
+		}
+	}
+
+	return values, nil
+}
@@ -0,0 +1,44 @@
+/*
+ * jitter.go - randomized start and per-target offsets, to spread the load
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"hash/crc32"
+	"math/rand"
+	"os"
+	"time"
+)
+
+var (
+	startJitter  durationFlag
+	targetSpread durationFlag
+)
+
+func init() {
+	flag.Var(&startJitter, "start-jitter", "wait a random delay up to this before the first cycle, in seconds or as a duration such as \"500ms\" or \"2m\", so that a fleet of hosts does not poll at the same second")
+	flag.Var(&targetSpread, "target-spread", "spread the polling of the targets over this much of each cycle, in seconds or as a duration, each one at its own fixed offset")
+}
+
+// Return a random delay up to -start-jitter.
+func startJitterDelay() time.Duration {
+	if startJitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(startJitter)))
+}
+
+// Return how long to wait before polling the target on every cycle. The
+// offset is derived from the local host name and the server, so that it is
+// stable from one cycle to the next but differs from host to host.
+func (t *target) phaseOffset() time.Duration {
+	spread := time.Duration(targetSpread).Milliseconds()
+	if spread <= 0 {
+		return 0
+	}
+	local, _ := os.Hostname()
+	return time.Duration(int64(crc32.ChecksumIEEE([]byte(local+"/"+t.server)))%spread) * time.Millisecond
+}
@@ -0,0 +1,42 @@
+/*
+ * jitter_test.go - tests of the randomized start and per-target offsets
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestJitterDurations(t *testing.T) {
+	defer func(jitter, spread durationFlag) {
+		startJitter, targetSpread = jitter, spread
+	}(startJitter, targetSpread)
+
+	tests := []struct {
+		value string
+		max   time.Duration
+	}{
+		{"0", 0},
+		{"2", 2 * time.Second},
+		{"1.5", 1500 * time.Millisecond},
+		{"500ms", 500 * time.Millisecond},
+		{"2m", 2 * time.Minute},
+	}
+	for _, test := range tests {
+		if err := startJitter.Set(test.value); err != nil {
+			t.Fatalf("-start-jitter %s: %v", test.value, err)
+		}
+		if err := targetSpread.Set(test.value); err != nil {
+			t.Fatalf("-target-spread %s: %v", test.value, err)
+		}
+		if d := startJitterDelay(); d < 0 || d > test.max || test.max == 0 && d != 0 {
+			t.Errorf("startJitterDelay() with -start-jitter %s = %v, expected up to %v", test.value, d, test.max)
+		}
+		if d := newTarget("solr1.example.com:8983").phaseOffset(); d < 0 || d > test.max || test.max == 0 && d != 0 {
+			t.Errorf("phaseOffset() with -target-spread %s = %v, expected up to %v", test.value, d, test.max)
+		}
+	}
+}
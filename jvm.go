@@ -0,0 +1,58 @@
+/*
+ * jvm.go - JVM heap and memory metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import "flag"
+
+var jvmStats = flag.Bool("jvm-stats", false, "collect JVM heap and non-heap memory usage")
+
+// JVM memory stats we report, keyed by their name in the metrics API.
+var jvmFields = []struct{ key, name string }{
+	{"memory.heap.used", "heap_used"},
+	{"memory.heap.committed", "heap_committed"},
+	{"memory.heap.max", "heap_max"},
+	{"memory.non-heap.used", "nonheap_used"},
+	{"memory.non-heap.committed", "nonheap_committed"},
+}
+
+// Collect the JVM memory usage. Falls back to the system info handler
+// (heap only) on Solr versions without the metrics API.
+func getJVMValues(t *target, core string) ([]Value, error) {
+	registries, err := getMetrics(t, "jvm", "memory.heap.,memory.non-heap.")
+	if err != nil {
+		return getJVMSystemValues(t)
+	}
+	registry := registries.S("solr.jvm")
+
+	var values []Value
+	for _, f := range jvmFields {
+		if v, ok := registry.S(f.key).Data().(float64); ok {
+			values = append(values, Value{Type: "gauge", Name: "jvm_" + f.name, Value: v})
+		}
+	}
+	return values, nil
+}
+
+// Collect the JVM heap usage from the system info handler.
+func getJVMSystemValues(t *target) ([]Value, error) {
+	data, err := getSystemInfo(t)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := data.S("jvm", "memory", "raw")
+	var values []Value
+	for _, f := range []struct{ key, name string }{
+		{"used", "heap_used"},
+		{"total", "heap_committed"},
+		{"max", "heap_max"},
+	} {
+		if v, ok := raw.S(f.key).Data().(float64); ok {
+			values = append(values, Value{Type: "gauge", Name: "jvm_" + f.name, Value: v})
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,137 @@
+/*
+ * kerberos.go - SPNEGO authentication to Solr servers secured with Kerberos
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+)
+
+var (
+	krbKeytab    = flag.String("keytab", "", "keytab to authenticate to Solr with over Kerberos, as -principal")
+	krbPrincipal = flag.String("principal", "", "Kerberos principal of -keytab, e.g. \"solr-status@EXAMPLE.COM\"")
+	krbCCache    = flag.String("krb5-ccache", "", "Kerberos credential cache to authenticate to Solr with, e.g. \"/tmp/krb5cc_1000\"")
+	krbConf      = flag.String("krb5-conf", "/etc/krb5.conf", "Kerberos configuration file")
+	krbSPN       = flag.String("spn", "", "service principal of the Solr servers (\"HTTP/<server host>\" by default)")
+)
+
+// Client logged in to Kerberos, nil when Kerberos is not used, and the
+// modification time of the credential cache it was loaded from.
+var (
+	krbClient    *client.Client
+	krbCCacheMod time.Time
+	krbMutex     sync.Mutex
+)
+
+// Log in to Kerberos with the keytab or the credential cache, if any. The
+// previous client is kept until the new one is logged in.
+func loadKerberos() error {
+	if *krbKeytab == "" && *krbCCache == "" {
+		setKerberosClient(nil, time.Time{})
+		return nil
+	}
+	if *krbKeytab != "" && *krbCCache != "" {
+		return fmt.Errorf("-keytab and -krb5-ccache cannot be used together")
+	}
+	if *solrUser != "" {
+		return fmt.Errorf("-user cannot be used with Kerberos")
+	}
+
+	cfg, err := config.Load(*krbConf)
+	if err != nil {
+		return fmt.Errorf("cannot load Kerberos configuration: %v", err)
+	}
+
+	if *krbCCache != "" {
+		cl, mod, err := loadCCache(cfg)
+		if err != nil {
+			return err
+		}
+		setKerberosClient(cl, mod)
+		return nil
+	}
+
+	i := strings.LastIndex(*krbPrincipal, "@")
+	if i <= 0 {
+		return fmt.Errorf("invalid principal '%s': expected user@REALM", *krbPrincipal)
+	}
+	kt, err := keytab.Load(*krbKeytab)
+	if err != nil {
+		return fmt.Errorf("cannot load keytab: %v", err)
+	}
+	cl := client.NewWithKeytab((*krbPrincipal)[:i], (*krbPrincipal)[i+1:], kt, cfg, client.DisablePAFXFAST(true))
+	if err := cl.Login(); err != nil {
+		return fmt.Errorf("cannot log in to Kerberos: %v", err)
+	}
+	setKerberosClient(cl, time.Time{})
+	return nil
+}
+
+// Replace the Kerberos client, nil to stop using Kerberos.
+func setKerberosClient(cl *client.Client, ccacheMod time.Time) {
+	krbMutex.Lock()
+	defer krbMutex.Unlock()
+	if krbClient != nil {
+		krbClient.Destroy()
+	}
+	krbClient, krbCCacheMod = cl, ccacheMod
+}
+
+// Load a client from the tickets of the credential cache, which it cannot
+// renew by itself: kinit or k5start are expected to do so. Also return the
+// modification time of the cache.
+func loadCCache(cfg *config.Config) (*client.Client, time.Time, error) {
+	fi, err := os.Stat(*krbCCache)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("cannot load credential cache: %v", err)
+	}
+	cc, err := credentials.LoadCCache(*krbCCache)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("cannot load credential cache: %v", err)
+	}
+	cl, err := client.NewFromCCache(cc, cfg, client.DisablePAFXFAST(true))
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("cannot load credential cache: %v", err)
+	}
+	return cl, fi.ModTime(), nil
+}
+
+// Add a SPNEGO token to a request. The credential cache is loaded again
+// whenever it changed, so that renewed tickets are picked up.
+func negotiate(req *http.Request) error {
+	krbMutex.Lock()
+	defer krbMutex.Unlock()
+
+	if krbClient == nil {
+		return nil
+	}
+	if *krbCCache != "" {
+		if fi, err := os.Stat(*krbCCache); err == nil && !fi.ModTime().Equal(krbCCacheMod) {
+			cl, mod, err := loadCCache(krbClient.Config)
+			if err != nil {
+				warnf("%v", err)
+			} else {
+				krbClient.Destroy()
+				krbClient, krbCCacheMod = cl, mod
+			}
+		}
+	}
+	if err := spnego.SetSPNEGOHeader(krbClient, req, *krbSPN); err != nil {
+		return fmt.Errorf("cannot negotiate with Kerberos: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+/*
+ * kubernetes.go - discovery of Solr pods through the Kubernetes API
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Jeffail/gabs"
+)
+
+// Where the pod's service account credentials are mounted.
+const k8sServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+var (
+	k8sSelector  = flag.String("k8s-selector", "", "discover the Solr pods matching this Kubernetes label selector, e.g. \"app=solr\"")
+	k8sNamespace = flag.String("k8s-namespace", "", "namespace of the Solr pods (defaults to the plugin's own namespace)")
+	k8sPort      = flag.Int("k8s-port", 8983, "port Solr listens to in the pods")
+	k8sAPI       = flag.String("k8s-api", "", "URL of the Kubernetes API (defaults to the in-cluster one), e.g. \"http://127.0.0.1:8001\" for kubectl proxy")
+)
+
+// Return one target per running and ready pod matching the label selector.
+// Pods come and go, so they are listed again on every cycle and their values
+// are reported under the pod name rather than its address.
+func discoverK8sTargets(known map[string]*target) ([]*target, error) {
+	api, client, token, err := k8sClient()
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := *k8sNamespace
+	if namespace == "" {
+		if b, err := ioutil.ReadFile(k8sServiceAccountDir + "/namespace"); err == nil {
+			namespace = strings.TrimSpace(string(b))
+		} else {
+			namespace = "default"
+		}
+	}
+
+	req, err := http.NewRequestWithContext(cycleContext, "GET", fmt.Sprintf("%s/api/v1/namespaces/%s/pods?labelSelector=%s",
+		api, url.PathEscape(namespace), url.QueryEscape(*k8sSelector)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list pods: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	r, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list pods: %v", err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot list pods: got status code %d, expected 200", r.StatusCode)
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read pod list: %v", err)
+	}
+	data, err := gabs.ParseJSON(body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse pod list: %v", err)
+	}
+
+	var servers []string
+	pods := make(map[string]string)
+	for _, pod := range data.S("items").Children() {
+		ip, _ := pod.Path("status.podIP").Data().(string)
+		name, _ := pod.Path("metadata.name").Data().(string)
+		if ip == "" || !podReady(pod) {
+			continue
+		}
+		server := net.JoinHostPort(ip, strconv.Itoa(*k8sPort))
+		servers = append(servers, server)
+		pods[server] = name
+	}
+
+	targets := syncTargets(known, servers)
+	if len(targets) > 1 {
+		for _, t := range targets {
+			t.host = pods[t.server]
+		}
+	}
+	return targets, nil
+}
+
+// Return whether a pod is running and ready to serve requests.
+func podReady(pod *gabs.Container) bool {
+	if phase, _ := pod.Path("status.phase").Data().(string); phase != "Running" {
+		return false
+	}
+	for _, condition := range pod.Path("status.conditions").Children() {
+		if t, _ := condition.S("type").Data().(string); t == "Ready" {
+			status, _ := condition.S("status").Data().(string)
+			return status == "True"
+		}
+	}
+	return false
+}
+
+// Return the URL of the Kubernetes API, an HTTP client trusting its
+// certificate and the service account token, when running in a pod.
+func k8sClient() (string, *http.Client, string, error) {
+	client := &http.Client{Timeout: httpTimeout()}
+
+	var token string
+	if b, err := ioutil.ReadFile(k8sServiceAccountDir + "/token"); err == nil {
+		token = strings.TrimSpace(string(b))
+	}
+	if *k8sAPI != "" {
+		return strings.TrimRight(*k8sAPI, "/"), client, token, nil
+	}
+
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return "", nil, "", fmt.Errorf("not running in Kubernetes: please specify the API URL with -k8s-api")
+	}
+	ca, err := ioutil.ReadFile(k8sServiceAccountDir + "/ca.crt")
+	if err != nil {
+		return "", nil, "", fmt.Errorf("cannot read the Kubernetes CA certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+	client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+
+	return "https://" + net.JoinHostPort(host, port), client, token, nil
+}
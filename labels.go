@@ -0,0 +1,115 @@
+/*
+ * labels.go - static key=value labels attached to the values
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var labelSpecs listFlag
+
+// Labels attached to every value, from -label.
+var globalLabels map[string]string
+
+func init() {
+	flag.Var(&labelSpecs, "label", "key=value label attached to every value, e.g. \"env=prod\" (comma-separated or repeated; labels of a single server follow it, e.g. -server \"solr1:8983 dc=eu\")")
+}
+
+// Parse the -label flags.
+func compileLabels() error {
+	labels, err := parseLabels(labelSpecs)
+	if err != nil {
+		return err
+	}
+	globalLabels = labels
+	return nil
+}
+
+// Parse key=value labels.
+func parseLabels(specs []string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid label '%s': expected key=value", spec)
+		}
+		labels[parts[0]] = parts[1]
+	}
+	return labels, nil
+}
+
+// Split a server as given to -server or in a targets file, e.g.
+// "solr1:8983 dc=eu team=search header.X-API-Key=secret", into the server,
+// its labels and its headers.
+func parseTargetSpec(spec string) (string, map[string]string, map[string]string, error) {
+	fields := strings.Fields(spec)
+	if len(fields) == 0 {
+		return "", nil, nil, fmt.Errorf("empty server")
+	}
+	var labelFields, headerFields []string
+	for _, f := range fields[1:] {
+		if strings.HasPrefix(f, headerPrefix) {
+			headerFields = append(headerFields, strings.TrimPrefix(f, headerPrefix))
+		} else {
+			labelFields = append(labelFields, f)
+		}
+	}
+	labels, err := parseLabels(labelFields)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("server %s: %v", fields[0], err)
+	}
+	headers, err := parseLabels(headerFields)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("server %s: %v", fields[0], err)
+	}
+	for name := range headers {
+		if !validHeaderName(name) {
+			return "", nil, nil, fmt.Errorf("server %s: invalid header name '%s'", fields[0], name)
+		}
+	}
+	return fields[0], labels, headers, nil
+}
+
+// Return the labels of the values of the target: its own, and the -label ones.
+func (t *target) valueLabels() map[string]string {
+	if len(t.labels) == 0 {
+		return globalLabels
+	}
+	labels := make(map[string]string)
+	for k, v := range globalLabels {
+		labels[k] = v
+	}
+	for k, v := range t.labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// Return the plugin instance of a value with the given labels, which PUTVAL
+// has no other place for: "key_value" pairs sorted by key, followed by the
+// instance, e.g. "dc_eu.env_prod.core.products".
+func labelInstance(labels map[string]string, instance string) string {
+	if len(labels) == 0 {
+		return instance
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys)+1)
+	for _, k := range keys {
+		parts = append(parts, metricName(k+"_"+labels[k]))
+	}
+	if instance != "" {
+		parts = append(parts, instance)
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,66 @@
+/*
+ * labels_test.go - tests of the labels of the values
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLabels(t *testing.T) {
+	tests := []struct {
+		specs    []string
+		expected map[string]string // nil for an error
+	}{
+		{nil, map[string]string{}},
+		{[]string{"dc=eu", "team=search"}, map[string]string{"dc": "eu", "team": "search"}},
+		{[]string{"query=a=b"}, map[string]string{"query": "a=b"}},
+		{[]string{"dc=eu", "dc=us"}, map[string]string{"dc": "us"}},
+		{[]string{"dc"}, nil},
+		{[]string{"=eu"}, nil},
+		{[]string{"dc="}, nil},
+	}
+	for _, test := range tests {
+		labels, err := parseLabels(test.specs)
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("parseLabels(%v) = %v, expected an error", test.specs, labels)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(labels, test.expected) {
+			t.Errorf("parseLabels(%v) = %v, %v, expected %v", test.specs, labels, err, test.expected)
+		}
+	}
+}
+
+func TestParseTargetSpec(t *testing.T) {
+	tests := []struct {
+		spec            string
+		server          string // empty for an error
+		labels, headers map[string]string
+	}{
+		{"solr1:8983", "solr1:8983", map[string]string{}, map[string]string{}},
+		{"  solr1:8983   dc=eu  ", "solr1:8983", map[string]string{"dc": "eu"}, map[string]string{}},
+		{"solr1:8983 dc=eu team=search", "solr1:8983", map[string]string{"dc": "eu", "team": "search"}, map[string]string{}},
+		{"", "", nil, nil},
+		{"solr1:8983 dc", "", nil, nil},
+		{"solr1:8983 dc=", "", nil, nil},
+	}
+	for _, test := range tests {
+		server, labels, headers, err := parseTargetSpec(test.spec)
+		if test.server == "" {
+			if err == nil {
+				t.Errorf("parseTargetSpec(%q) = %s, expected an error", test.spec, server)
+			}
+			continue
+		}
+		if err != nil || server != test.server || !reflect.DeepEqual(labels, test.labels) || !reflect.DeepEqual(headers, test.headers) {
+			t.Errorf("parseTargetSpec(%q) = %s, %v, %v, %v, expected %s, %v, %v",
+				test.spec, server, labels, headers, err, test.server, test.labels, test.headers)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+/*
+ * logging.go - leveled, optionally JSON, logging to stderr or a rotated file
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+var (
+	logLevel  = flag.String("log-level", "info", "minimum level of the messages logged: debug, info, warn or error")
+	logFormat = flag.String("log-format", "text", "format of the messages logged: text, or json for one object per line")
+
+	logFile       = flag.String("log-file", "", "log to this file instead of stderr, rotating it by size")
+	logMaxSize    = flag.Int("log-max-size", 100, "size in MB the log file is rotated at")
+	logMaxAge     = flag.Int("log-max-age", 0, "days rotated log files are kept for (forever if 0)")
+	logMaxBackups = flag.Int("log-max-backups", 0, "how many rotated log files are kept (all if 0)")
+)
+
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+// Index in logLevels of the least severe level logged.
+var minLogLevel = 1
+
+// The rotated log file, if any.
+var logRotator *lumberjack.Logger
+
+// Where messages are sent instead of the log when set, e.g. the Windows event
+// log when running as a service.
+var eventLogger func(level int, msg string)
+
+// Check and apply the logging flags. The log file is reopened, so that its
+// settings can be changed on reload.
+func setupLogging() error {
+	level := -1
+	for i, name := range logLevels {
+		if name == *logLevel {
+			level = i
+		}
+	}
+	if level < 0 {
+		return fmt.Errorf("invalid log level '%s': expected one of %s", *logLevel, strings.Join(logLevels, ", "))
+	}
+
+	switch *logFormat {
+	case "text":
+		log.SetFlags(log.LstdFlags)
+	case "json":
+		log.SetFlags(0)
+	default:
+		return fmt.Errorf("invalid log format '%s': expected text or json", *logFormat)
+	}
+	if *logMaxSize < 1 || *logMaxAge < 0 || *logMaxBackups < 0 {
+		return fmt.Errorf("invalid log rotation: the size must be at least 1 MB, and the age and backups cannot be negative")
+	}
+	minLogLevel = level
+
+	previous := logRotator
+	logRotator = nil
+	if *logFile != "" {
+		logRotator = &lumberjack.Logger{Filename: *logFile, MaxSize: *logMaxSize, MaxAge: *logMaxAge,
+			MaxBackups: *logMaxBackups, LocalTime: true}
+		log.SetOutput(logRotator)
+	} else {
+		log.SetOutput(os.Stderr)
+	}
+	if previous != nil {
+		previous.Close()
+	}
+	return nil
+}
+
+// Log a message at the given level, if it is not below -log-level.
+func logf(level int, format string, args ...interface{}) {
+	if level < minLogLevel {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	if eventLogger != nil {
+		eventLogger(level, msg)
+		return
+	}
+
+	if *logFormat == "json" {
+		line, _ := json.Marshal(struct {
+			Time  string `json:"time"`
+			Level string `json:"level"`
+			Msg   string `json:"msg"`
+		}{time.Now().Format(time.RFC3339), logLevels[level], msg})
+		log.Print(string(line))
+		return
+	}
+	log.Printf("%s: %s", strings.ToUpper(logLevels[level]), msg)
+}
+
+func debugf(format string, args ...interface{}) { logf(0, format, args...) }
+func infof(format string, args ...interface{})  { logf(1, format, args...) }
+func warnf(format string, args ...interface{})  { logf(2, format, args...) }
+func errorf(format string, args ...interface{}) { logf(3, format, args...) }
@@ -0,0 +1,61 @@
+/*
+ * memory.go - memory ceiling enforcement
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+var maxMemoryMB = flag.Int("max-memory-mb", 0, "memory ceiling in MB: above it, old history is shed and heavy collectors are skipped")
+
+// What has been dropped so far to stay below the memory ceiling. Targets are
+// polled concurrently, hence the atomic collectors count.
+var (
+	shedSamples    int
+	shedCollectors int64
+)
+
+// Tell the Go runtime about the memory ceiling, so that it collects garbage
+// more aggressively when getting close to it.
+func setMemoryLimit() {
+	if *maxMemoryMB > 0 {
+		debug.SetMemoryLimit(int64(*maxMemoryMB) << 20)
+	}
+}
+
+// Check whether the process is above the memory ceiling. If it is, shed the
+// oldest half of the history and give the memory back to the OS.
+func enforceMemoryCeiling(h *history) bool {
+	if *maxMemoryMB <= 0 {
+		return false
+	}
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	if m.HeapAlloc <= uint64(*maxMemoryMB)<<20 {
+		return false
+	}
+
+	if h != nil {
+		shedSamples += h.shed()
+	}
+	debug.FreeOSMemory()
+	return true
+}
+
+// Return the shed counters as values.
+func memoryValues() []Value {
+	if *maxMemoryMB <= 0 {
+		return nil
+	}
+	return []Value{
+		{Type: "derive", Name: "shed_samples", Value: float64(shedSamples)},
+		{Type: "derive", Name: "shed_collectors", Value: float64(atomic.LoadInt64(&shedCollectors))},
+	}
+}
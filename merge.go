@@ -0,0 +1,48 @@
+/*
+ * merge.go - index merge activity metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import "flag"
+
+var mergeStats = flag.Bool("merge-stats", false, "collect running merges, merged docs and mean merge time (requires mergeDetails in solrconfig.xml)")
+
+// Merge stats we report, keyed by their name in the metrics API.
+var mergeFields = []struct{ key, typ, name string }{
+	{"INDEX.merge.major.running", "gauge", "merge_major_running"},
+	{"INDEX.merge.minor.running", "gauge", "merge_minor_running"},
+	{"INDEX.merge.major.running.docs", "gauge", "merge_major_running_docs"},
+	{"INDEX.merge.major.running.segments", "gauge", "merge_major_running_segments"},
+	{"INDEX.merge.major", "derive", "merge_major"},
+	{"INDEX.merge.minor", "derive", "merge_minor"},
+	{"INDEX.merge.major.docs", "derive", "merge_major_docs"},
+	{"INDEX.merge.major.deletedDocs", "derive", "merge_major_deleteddocs"},
+	{"INDEX.merge.errors", "derive", "merge_errors"},
+}
+
+// Collect the merge activity of the specified core. Solr only tracks it when
+// the index writer metrics are enabled (<metrics><bool name="mergeDetails">).
+func getMergeValues(t *target, core string) ([]Value, error) {
+	registry, err := getCoreMetrics(t, core, "INDEX.merge.")
+	if err != nil {
+		return nil, err
+	}
+
+	var values []Value
+	for _, f := range mergeFields {
+		if v, ok := metricCount(registry.S(f.key)); ok {
+			values = append(values, Value{Type: f.typ, Name: f.name, Value: v})
+		}
+	}
+
+	// Merge timers only keep a mean duration (in ms) over recent merges, which
+	// can go down: report it as such, the count being the merge_<kind> derive.
+	for _, kind := range []string{"major", "minor"} {
+		if mean, ok := registry.S("INDEX.merge."+kind, "mean_ms").Data().(float64); ok {
+			values = append(values, Value{Type: "gauge", Name: "merge_" + kind + "_time_mean", Value: mean})
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,33 @@
+/*
+ * merge_test.go - tests of the index merge activity metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeValues(t *testing.T) {
+	target := newTestTarget(t, map[string]string{"/admin/metrics": `{"metrics": {"solr.core.products": {
+		"CORE.coreName": "products",
+		"INDEX.merge.major": {"count": 4, "mean_ms": 1500.5},
+		"INDEX.merge.minor": {"count": 40},
+		"INDEX.merge.major.running": 1
+	}}}`})
+	values, err := getMergeValues(target, "products")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Value{
+		{Type: "gauge", Name: "merge_major_running", Value: 1},
+		{Type: "derive", Name: "merge_major", Value: 4},
+		{Type: "derive", Name: "merge_minor", Value: 40},
+		{Type: "gauge", Name: "merge_major_time_mean", Value: 1500.5},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("getMergeValues() = %v, expected %v", values, expected)
+	}
+}
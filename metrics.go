@@ -0,0 +1,127 @@
+/*
+ * metrics.go - generic collector for the /admin/metrics API
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/Jeffail/gabs"
+)
+
+var (
+	metricsEnabled = flag.Bool("metrics", false, "collect everything returned by the /admin/metrics API")
+	metricsGroup   = flag.String("metrics-group", "all", "comma-separated metric groups to collect (all, jvm, jetty, node, core)")
+	metricsPrefix  = flag.String("metrics-prefix", "", "comma-separated metric name prefixes to collect")
+)
+
+// Query the metrics API with the given group and prefix filters, and
+// return the registries found in the reply.
+func getMetrics(t *target, group, prefix string) (*gabs.Container, error) {
+	params := url.Values{}
+	if group != "" {
+		params.Set("group", group)
+	}
+	if prefix != "" {
+		params.Set("prefix", prefix)
+	}
+	return queryMetrics(t, params)
+}
+
+// Query the metrics API with the given parameters, and return the
+// registries found in the reply.
+func queryMetrics(t *target, params url.Values) (*gabs.Container, error) {
+	params.Set("wt", "json")
+	params.Set("compact", "true")
+
+	data, err := getParsedJson(t.baseURL() + "/admin/metrics?" + params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	if !data.Exists("metrics") {
+		return nil, fmt.Errorf("no metrics found in the reply (the metrics API requires Solr 6.4 or later)")
+	}
+
+	return data.S("metrics"), nil
+}
+
+// Query the metrics API for the given prefixes and return the registry of the
+// specified core, which is recognized by its CORE.coreName gauge.
+func getCoreMetrics(t *target, core string, prefixes ...string) (*gabs.Container, error) {
+	prefixes = append(prefixes, "CORE.coreName")
+	registries, err := getMetrics(t, "core", strings.Join(prefixes, ","))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, registry := range registries.ChildrenMap() {
+		if name, ok := registry.S("CORE.coreName").Data().(string); ok && name == core {
+			return registry, nil
+		}
+	}
+	return nil, fmt.Errorf("no metrics could be found for the index '%s'", core)
+}
+
+// Collect every numeric metric matching the configured filters.
+func getMetricsValues(t *target, core string) ([]Value, error) {
+	registries, err := getMetrics(t, *metricsGroup, *metricsPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []Value
+	for _, name := range sortedKeys(registries) {
+		values = flattenMetrics(strings.TrimPrefix(name, "solr."), "", registries.S(name), values)
+	}
+	return values, nil
+}
+
+// Flatten a (possibly nested) metric into values, joining the keys with dots.
+// Counts are reported as derives, everything else as gauges.
+func flattenMetrics(instance, name string, c *gabs.Container, values []Value) []Value {
+	switch v := c.Data().(type) {
+	case float64:
+		typ := "gauge"
+		if strings.HasSuffix(name, ".count") || name == "count" {
+			typ = "derive"
+		}
+		values = append(values, Value{Instance: instance, Type: typ, Name: metricName(name), Value: v})
+	case map[string]interface{}:
+		children := c.ChildrenMap()
+		for _, key := range sortedKeys(c) {
+			full := key
+			if name != "" {
+				full = name + "." + key
+			}
+			values = flattenMetrics(instance, full, children[key], values)
+		}
+	}
+	return values
+}
+
+// Return the keys of a gabs object, sorted.
+func sortedKeys(c *gabs.Container) []string {
+	children := c.ChildrenMap()
+	keys := make([]string, 0, len(children))
+	for key := range children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Turn a Solr metric name into something safe to use in a collectd identifier.
+func metricName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, name)
+}
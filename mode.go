@@ -0,0 +1,64 @@
+/*
+ * mode.go - running under collectd's exec plugin or as a standalone daemon
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+// Where the health endpoints are served in daemon mode, unless -health-addr
+// says otherwise.
+const defaultDaemonHealthAddr = ":8080"
+
+var (
+	mode    = flag.String("mode", "exec", "exec to run under the collectd exec plugin, obeying COLLECTD_HOSTNAME and COLLECTD_INTERVAL, or daemon to run standalone, serving the health endpoints on :8080 by default")
+	pidFile = flag.String("pid-file", "", "write the process id to this file, removed on exit (daemon mode)")
+)
+
+// Check -mode.
+func checkMode() error {
+	switch *mode {
+	case "exec":
+		if *pidFile != "" {
+			return fmt.Errorf("-pid-file requires -mode daemon")
+		}
+	case "daemon":
+	default:
+		return fmt.Errorf("invalid mode '%s': expected exec or daemon", *mode)
+	}
+	return nil
+}
+
+// Return the value of a collectd environment variable, which only the exec
+// mode obeys.
+func collectdEnv(name string) string {
+	if *mode != "exec" {
+		return ""
+	}
+	return os.Getenv(name)
+}
+
+// Write the process id to -pid-file, if set.
+func writePidFile() error {
+	if *pidFile == "" {
+		return nil
+	}
+	if err := ioutil.WriteFile(*pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		return fmt.Errorf("cannot write pid file: %v", err)
+	}
+	return nil
+}
+
+// Remove the -pid-file written on start, if any.
+func removePidFile() {
+	if *pidFile != "" {
+		os.Remove(*pidFile)
+	}
+}
@@ -0,0 +1,59 @@
+/*
+ * overseer.go - SolrCloud overseer status metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+var overseerStats = flag.Bool("overseer-stats", false, "collect overseer queue sizes and operation stats from OVERSEERSTATUS (SolrCloud)")
+
+// Collect the overseer queue depths and the stats of every overseer and
+// collection operation, under the "overseer" plugin instance.
+func getOverseerValues(t *target, core string) ([]Value, error) {
+	data, err := getParsedJson(t.baseURL() + "/admin/collections?action=OVERSEERSTATUS&json.nl=map&wt=json")
+	if err != nil {
+		return nil, err
+	}
+	if !data.Exists("leader") {
+		return nil, fmt.Errorf("no overseer status found in the reply (is Solr running in SolrCloud mode?)")
+	}
+
+	var values []Value
+	for _, f := range []struct{ key, name string }{
+		{"overseer_queue_size", "queue_size"},
+		{"overseer_work_queue_size", "work_queue_size"},
+		{"overseer_collection_queue_size", "collection_queue_size"},
+	} {
+		if v, ok := data.S(f.key).Data().(float64); ok {
+			values = append(values, Value{Instance: "overseer", Type: "gauge", Name: f.name, Value: v})
+		}
+	}
+
+	for _, group := range []struct{ key, prefix string }{
+		{"overseer_operations", "op_"},
+		{"collection_operations", "collection_op_"},
+	} {
+		operations := data.S(group.key)
+		for _, op := range sortedKeys(operations) {
+			stats := operations.S(op)
+			name := group.prefix + metricName(strings.ToLower(op))
+			if v, ok := stats.S("requests").Data().(float64); ok {
+				values = append(values, Value{Instance: "overseer", Type: "derive", Name: name + "_requests", Value: v})
+			}
+			if v, ok := stats.S("errors").Data().(float64); ok {
+				values = append(values, Value{Instance: "overseer", Type: "derive", Name: name + "_errors", Value: v})
+			}
+			if v, ok := stats.S("avgTimePerRequest").Data().(float64); ok {
+				values = append(values, Value{Instance: "overseer", Type: "gauge", Name: name + "_avgtime", Value: v})
+			}
+		}
+	}
+
+	return values, nil
+}
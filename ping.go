@@ -0,0 +1,39 @@
+/*
+ * ping.go - black-box availability probe using the ping handler
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+var pingProbe = flag.Bool("ping", false, "probe the core's ping handler and report its latency and availability")
+
+// Ping the specified core and report whether it answered "OK", and how long
+// it took (in ms) when it did.
+func getPingValues(t *target, core string) ([]Value, error) {
+	start := time.Now()
+	data, err := getParsedJson(fmt.Sprintf("%s/%s/admin/ping?wt=json",
+		t.baseURL(),
+		url.PathEscape(core)))
+	latency := time.Since(start)
+
+	if err == nil {
+		if status, _ := data.S("status").Data().(string); status != "OK" {
+			err = fmt.Errorf("ping of the index '%s' returned status '%s'", core, status)
+		}
+	}
+	if err != nil {
+		return []Value{{Type: "gauge", Name: "ping_ok", Value: 0}}, err
+	}
+
+	return []Value{
+		{Type: "gauge", Name: "ping_ok", Value: 1},
+		{Type: "gauge", Name: "ping_latency", Value: float64(latency.Microseconds()) / 1000},
+	}, nil
+}
@@ -0,0 +1,43 @@
+/*
+ * pool.go - inter-node HTTP connection pool metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import "flag"
+
+var poolStats = flag.Bool("pool-stats", false, "collect the connection pool stats of the HTTP clients used between nodes")
+
+// HTTP clients Solr uses to talk to other nodes, keyed by their metric prefix.
+var connectionPools = []struct{ prefix, name string }{
+	{"QUERY.httpShardHandler.", "pool_query"},
+	{"UPDATE.updateShardHandler.", "pool_update"},
+}
+
+var poolFields = []struct{ key, name string }{
+	{"availableConnections", "available"},
+	{"leasedConnections", "leased"},
+	{"pendingConnections", "pending"},
+	{"maxConnections", "max"},
+}
+
+// Collect the available, leased and pending connections of the distributed
+// search and update HTTP clients.
+func getPoolValues(t *target, core string) ([]Value, error) {
+	registries, err := getMetrics(t, "node", "QUERY.httpShardHandler.,UPDATE.updateShardHandler.")
+	if err != nil {
+		return nil, err
+	}
+	registry := registries.S("solr.node")
+
+	var values []Value
+	for _, pool := range connectionPools {
+		for _, f := range poolFields {
+			if v, ok := registry.S(pool.prefix + f.key).Data().(float64); ok {
+				values = append(values, Value{Type: "gauge", Name: pool.name + "_" + f.name, Value: v})
+			}
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,47 @@
+/*
+ * proxy.go - forward proxy the Solr servers are reached through
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+var (
+	proxyURL     = flag.String("proxy", "", "forward proxy to reach the Solr servers through, e.g. \"http://proxy:3128\" (HTTP_PROXY and HTTPS_PROXY by default)")
+	noProxyHosts listFlag
+)
+
+func init() {
+	flag.Var(&noProxyHosts, "no-proxy", "server reached without the proxy: a host name, a domain such as \".example.com\" or a CIDR, as in NO_PROXY (comma-separated or repeated)")
+}
+
+// Make the requests to Solr go through the proxy, if any. The proxy
+// environment variables are used for what the flags do not set.
+func loadProxy() error {
+	config := httpproxy.FromEnvironment()
+	if *proxyURL != "" {
+		u, err := url.Parse(*proxyURL)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("invalid proxy '%s': expected a URL such as http://proxy:3128", *proxyURL)
+		}
+		config.HTTPProxy, config.HTTPSProxy = *proxyURL, *proxyURL
+	}
+	if len(noProxyHosts) > 0 {
+		config.NoProxy = strings.Join(noProxyHosts, ",")
+	}
+
+	proxy := config.ProxyFunc()
+	solrTransport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}
+	return nil
+}
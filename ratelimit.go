@@ -0,0 +1,37 @@
+/*
+ * ratelimit.go - request rate limiter metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+)
+
+var rateLimitStats = flag.Bool("ratelimit-stats", false, "collect request rate limiter slots in use and rejected requests")
+
+// The metrics of the rate limiter of query requests, the only ones Solr limits.
+const (
+	rateLimitSlotsInUse = "RATE_LIMITER.QUERY.slotsInUse"
+	rateLimitRejected   = "RATE_LIMITER.QUERY.rejected"
+)
+
+// Collect the slots in use and the rejected requests of Solr's request rate
+// limiter. Nothing is reported when rate limiting is not enabled.
+func getRateLimitValues(t *target, core string) ([]Value, error) {
+	registries, err := getMetrics(t, "node", "RATE_LIMITER.")
+	if err != nil {
+		return nil, err
+	}
+	metrics := registries.S("solr.node")
+
+	var values []Value
+	if v, ok := metricCount(metrics.S(rateLimitSlotsInUse)); ok {
+		values = append(values, Value{Type: "gauge", Name: "ratelimit_slots_in_use", Value: v})
+	}
+	if v, ok := metricCount(metrics.S(rateLimitRejected)); ok {
+		values = append(values, Value{Type: "derive", Name: "ratelimit_rejected", Value: v})
+	}
+	return values, nil
+}
@@ -0,0 +1,40 @@
+/*
+ * ratelimit_test.go - tests of the request rate limiter metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRateLimitValues(t *testing.T) {
+	tests := []struct {
+		reply    string
+		expected []Value
+	}{
+		{`{"metrics": {"solr.node": {}}}`, nil},
+		{`{"metrics": {"solr.node": {"RATE_LIMITER.QUERY.rejected": {"count": 7}}}}`, []Value{
+			{Type: "derive", Name: "ratelimit_rejected", Value: 7},
+		}},
+		{`{"metrics": {"solr.node": {
+			"RATE_LIMITER.QUERY.slotsInUse": 4,
+			"RATE_LIMITER.QUERY.rejected": 0,
+			"RATE_LIMITER.QUERY.activeSlotBorrowers": 9
+		}}}`, []Value{
+			{Type: "gauge", Name: "ratelimit_slots_in_use", Value: 4},
+			{Type: "derive", Name: "ratelimit_rejected", Value: 0},
+		}},
+	}
+	for _, test := range tests {
+		values, err := getRateLimitValues(newTestTarget(t, map[string]string{"/admin/metrics": test.reply}), "products")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(values, test.expected) {
+			t.Errorf("getRateLimitValues(%s) = %v, expected %v", test.reply, values, test.expected)
+		}
+	}
+}
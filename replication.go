@@ -0,0 +1,129 @@
+/*
+ * replication.go - replication handler metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/Jeffail/gabs"
+)
+
+// Format of the dates returned by the replication handler (java.util.Date.toString()).
+const replicationDateLayout = "Mon Jan _2 15:04:05 MST 2006"
+
+var (
+	replicationStats = flag.Bool("replication-stats", false, "collect index version, generation and lag from the replication handler")
+	solrTimezone     = flag.String("solr-timezone", "Local", "time zone of the Solr servers, e.g. Europe/Rome, which the replication handler dates are written in; the local one by default")
+)
+
+// The location of -solr-timezone.
+var solrLocation = time.Local
+
+// Load the location of -solr-timezone.
+func loadSolrTimezone() error {
+	loc, err := time.LoadLocation(*solrTimezone)
+	if err != nil {
+		return fmt.Errorf("invalid Solr time zone '%s': %v", *solrTimezone, err)
+	}
+	solrLocation = loc
+	return nil
+}
+
+// Parse a date of the replication handler. Its zone is an abbreviation, which
+// only tells the offset in the time zone of the server: zones other than UTC
+// and GMT which are not abbreviations of -solr-timezone are refused, rather
+// than read as UTC.
+func parseReplicationDate(s string) (time.Time, error) {
+	t, err := time.ParseInLocation(replicationDateLayout, s, solrLocation)
+	if err != nil {
+		return t, err
+	}
+	if zone, _ := t.Zone(); t.Location() != solrLocation && t.Location() != time.UTC && zone != "GMT" {
+		return time.Time{}, fmt.Errorf("unknown time zone '%s' in '%s': expected one of %s", zone, s, solrLocation)
+	}
+	return t, nil
+}
+
+// Collect the replication details of the specified core. Followers (slaves)
+// also report their lag and their last replication success and failure.
+func getReplicationValues(t *target, core string) ([]Value, error) {
+	data, err := getParsedJson(fmt.Sprintf("%s/%s/replication?command=details&wt=json",
+		t.baseURL(),
+		url.PathEscape(core)))
+	if err != nil {
+		return nil, err
+	}
+
+	details := data.S("details")
+	if details == nil {
+		return nil, fmt.Errorf("no replication details could be found for the index '%s'", core)
+	}
+
+	var values []Value
+	generation, hasGeneration := details.S("generation").Data().(float64)
+	if v, ok := details.S("indexVersion").Data().(float64); ok {
+		values = append(values, Value{Type: "gauge", Name: "replication_indexversion", Value: v})
+	}
+	if hasGeneration {
+		values = append(values, Value{Type: "gauge", Name: "replication_generation", Value: generation})
+	}
+
+	// Solr 8.7 renamed master/slave to leader/follower.
+	follower := details.S("follower")
+	if follower == nil {
+		follower = details.S("slave")
+	}
+	if follower == nil {
+		return values, nil
+	}
+
+	values = append(values, Value{Type: "gauge", Name: "replication_isreplicating",
+		Value: boolValue(follower.S("isReplicating"))})
+
+	leader := follower.S("leaderDetails")
+	if leader == nil {
+		leader = follower.S("masterDetails")
+	}
+	if leaderGeneration, ok := leader.S("generation").Data().(float64); ok && hasGeneration {
+		values = append(values, Value{Type: "gauge", Name: "replication_generation_lag",
+			Value: leaderGeneration - generation})
+	}
+
+	for _, f := range []struct{ key, name string }{
+		{"indexReplicatedAt", "replication_last_success"},
+		{"replicationFailedAt", "replication_last_failure"},
+	} {
+		s, ok := follower.S(f.key).Data().(string)
+		if !ok {
+			continue
+		}
+		if t, err := parseReplicationDate(s); err != nil {
+			warnf("%v", err)
+		} else {
+			values = append(values, Value{Type: "gauge", Name: f.name, Value: float64(t.Unix())})
+		}
+	}
+
+	return values, nil
+}
+
+// Return 1 for a true boolean (or "true" string) and 0 otherwise.
+func boolValue(c *gabs.Container) float64 {
+	switch v := c.Data().(type) {
+	case bool:
+		if v {
+			return 1
+		}
+	case string:
+		if v == "true" {
+			return 1
+		}
+	}
+	return 0
+}
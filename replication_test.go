@@ -0,0 +1,45 @@
+/*
+ * replication_test.go - tests of the replication handler metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseReplicationDate(t *testing.T) {
+	tests := []struct {
+		timezone, date string
+		expected       string // RFC 3339, empty for an error
+	}{
+		{"Europe/Rome", "Tue Mar 03 10:00:00 CET 2020", "2020-03-03T09:00:00Z"},
+		{"Europe/Rome", "Wed Jul 01 10:00:00 CEST 2020", "2020-07-01T08:00:00Z"},
+		{"Europe/Rome", "Wed Jul 01 10:00:00 UTC 2020", "2020-07-01T10:00:00Z"},
+		{"Europe/Rome", "Wed Jul 01 10:00:00 GMT 2020", "2020-07-01T10:00:00Z"},
+		{"Europe/Rome", "Tue Mar 03 10:00:00 EST 2020", ""},
+		{"America/New_York", "Tue Mar 03 10:00:00 EST 2020", "2020-03-03T15:00:00Z"},
+		{"Europe/Lisbon", "Tue Mar 03 10:00:00 WET 2020", "2020-03-03T10:00:00Z"},
+		{"UTC", "Tue Mar 3 10:00:00 UTC 2020", "2020-03-03T10:00:00Z"},
+		{"UTC", "2020-03-03T10:00:00Z", ""},
+	}
+	defer func() { *solrTimezone, solrLocation = "Local", time.Local }()
+	for _, test := range tests {
+		*solrTimezone = test.timezone
+		if err := loadSolrTimezone(); err != nil {
+			t.Fatal(err)
+		}
+		got, err := parseReplicationDate(test.date)
+		switch {
+		case test.expected == "" && err == nil:
+			t.Errorf("parseReplicationDate(%s) in %s = %v, expected an error", test.date, test.timezone, got)
+		case test.expected != "" && err != nil:
+			t.Errorf("parseReplicationDate(%s) in %s: %v", test.date, test.timezone, err)
+		case test.expected != "" && got.UTC().Format(time.RFC3339) != test.expected:
+			t.Errorf("parseReplicationDate(%s) in %s = %s, expected %s", test.date, test.timezone, got.UTC().Format(time.RFC3339), test.expected)
+		}
+	}
+}
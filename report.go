@@ -0,0 +1,190 @@
+/*
+ * report.go - periodic health summary sent by email or webhook
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const reportTopCores = 5
+const reportTopErrors = 5
+
+var (
+	reportPeriod  = flag.String("report", "", "send a health summary every \"daily\" or \"weekly\"")
+	reportWebhook = flag.String("report-webhook", "", "URL the health summary is POSTed to as JSON")
+	reportSMTP    = flag.String("report-smtp", "", "SMTP server (host:port) used to email the health summary")
+	reportFrom    = flag.String("report-from", "solr-status@localhost", "sender address of the health summary email")
+	reportTo      = flag.String("report-to", "", "comma-separated recipients of the health summary email")
+)
+
+// Growth of a single core over the reporting period.
+type coreGrowth struct {
+	Core        string
+	NumDocs     int
+	DocsDelta   int
+	SizeInBytes int
+	SizeDelta   int
+}
+
+// Parse the -report flag into a duration. Returns 0 if reports are disabled.
+func getReportPeriod() (time.Duration, error) {
+	switch *reportPeriod {
+	case "":
+		return 0, nil
+	case "daily":
+		return 24 * time.Hour, nil
+	case "weekly":
+		return 7 * 24 * time.Hour, nil
+	}
+	return 0, fmt.Errorf("invalid report period '%s': expected \"daily\" or \"weekly\"", *reportPeriod)
+}
+
+// Return when the next report is due: at midnight for daily reports and
+// on Monday at midnight for weekly ones.
+func nextReport(now time.Time, period time.Duration) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, 1)
+	if period > 24*time.Hour {
+		for next.Weekday() != time.Monday {
+			next = next.AddDate(0, 0, 1)
+		}
+	}
+	return next
+}
+
+// Send a summary of the history every period, until the process exits.
+func runReports(h *history, hostname string, period time.Duration) {
+	for {
+		time.Sleep(time.Until(nextReport(time.Now(), period)))
+
+		end := time.Now()
+		text := buildReport(h.since(end.Add(-period)), hostname, end.Add(-period), end)
+		if err := sendReport(hostname, text); err != nil {
+			errorf("%v", err)
+		}
+	}
+}
+
+// Aggregate the history entries into a human readable summary.
+func buildReport(entries []historyEntry, hostname string, start, end time.Time) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Solr health summary for %s\n", hostname)
+	fmt.Fprintf(&b, "Period: %s - %s\n\n", start.Format(time.RFC1123), end.Format(time.RFC1123))
+
+	if len(entries) == 0 {
+		b.WriteString("No data was collected during this period.\n")
+		return b.String()
+	}
+
+	// Availability and errors.
+	failures := 0
+	errorCounts := make(map[string]int)
+	for _, e := range entries {
+		if e.Err != nil {
+			failures++
+			errorCounts[e.Err.Error()]++
+		}
+	}
+	availability := 100 * float64(len(entries)-failures) / float64(len(entries))
+	fmt.Fprintf(&b, "Availability: %.2f%% (%d failed out of %d collections)\n\n",
+		availability, failures, len(entries))
+
+	// Growth per core, between the first and last successful collection.
+	first := make(map[string]SolrStatus)
+	last := make(map[string]SolrStatus)
+	for _, e := range entries {
+		if e.Err != nil {
+			continue
+		}
+		if _, ok := first[e.Core]; !ok {
+			first[e.Core] = e.Status
+		}
+		last[e.Core] = e.Status
+	}
+
+	var growth []coreGrowth
+	for core, l := range last {
+		f := first[core]
+		growth = append(growth, coreGrowth{
+			Core:        core,
+			NumDocs:     l.NumDocs,
+			DocsDelta:   l.NumDocs - f.NumDocs,
+			SizeInBytes: l.SizeInBytes,
+			SizeDelta:   l.SizeInBytes - f.SizeInBytes,
+		})
+	}
+	sort.Slice(growth, func(i, j int) bool {
+		return growth[i].SizeDelta > growth[j].SizeDelta
+	})
+	if len(growth) > reportTopCores {
+		growth = growth[:reportTopCores]
+	}
+
+	b.WriteString("Top growing cores:\n")
+	for _, g := range growth {
+		fmt.Fprintf(&b, "  %s: %d docs (%+d), %d bytes (%+d)\n",
+			g.Core, g.NumDocs, g.DocsDelta, g.SizeInBytes, g.SizeDelta)
+	}
+
+	if len(errorCounts) > 0 {
+		messages := make([]string, 0, len(errorCounts))
+		for msg := range errorCounts {
+			messages = append(messages, msg)
+		}
+		sort.Slice(messages, func(i, j int) bool {
+			return errorCounts[messages[i]] > errorCounts[messages[j]]
+		})
+		if len(messages) > reportTopErrors {
+			messages = messages[:reportTopErrors]
+		}
+
+		b.WriteString("\nMost frequent errors:\n")
+		for _, msg := range messages {
+			fmt.Fprintf(&b, "  %dx %s\n", errorCounts[msg], msg)
+		}
+	}
+
+	return b.String()
+}
+
+// Deliver the report to the configured webhook and/or email recipients.
+func sendReport(hostname, text string) error {
+	if *reportWebhook != "" {
+		body, err := json.Marshal(map[string]string{"host": hostname, "text": text})
+		if err != nil {
+			return fmt.Errorf("cannot encode report: %v", err)
+		}
+
+		httpClient := &http.Client{Timeout: httpTimeout()}
+		r, err := httpClient.Post(*reportWebhook, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("cannot send report to webhook: %v", err)
+		}
+		r.Body.Close()
+		if r.StatusCode/100 != 2 {
+			return fmt.Errorf("webhook did not accept the report: got status code %d", r.StatusCode)
+		}
+	}
+
+	if *reportSMTP != "" {
+		to := strings.Split(*reportTo, ",")
+		msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: Solr health summary for %s\r\n\r\n%s",
+			*reportFrom, *reportTo, hostname, strings.ReplaceAll(text, "\n", "\r\n"))
+		if err := smtp.SendMail(*reportSMTP, nil, *reportFrom, to, []byte(msg)); err != nil {
+			return fmt.Errorf("cannot send report by email: %v", err)
+		}
+	}
+
+	return nil
+}
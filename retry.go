@@ -0,0 +1,36 @@
+/*
+ * retry.go - retries of the failed requests to Solr
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"math/rand"
+	"time"
+)
+
+var (
+	maxAttempts  = flag.Int("max-attempts", 3, "how many times a request to Solr is attempted, when it fails in a way that may be transient")
+	retryBackoff = flag.Duration("retry-backoff", 200*time.Millisecond, "delay before the first retry of a request, doubled on every following one")
+)
+
+// Return how long to wait before attempting a request again, after the
+// given attempt failed: the backoff doubles on every attempt, up to the poll
+// interval, and a random half of it is taken off so that retries from
+// several clients spread out.
+func retryDelay(attempt int) time.Duration {
+	limit := pollInterval()
+	d := *retryBackoff
+	for i := 1; i < attempt && d < limit; i++ {
+		d *= 2
+	}
+	if d > limit {
+		d = limit
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
@@ -0,0 +1,42 @@
+/*
+ * retry_test.go - tests of the retries of failed requests
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	defer func(backoff time.Duration, interval durationFlag) {
+		*retryBackoff, cycleInterval = backoff, interval
+	}(*retryBackoff, cycleInterval)
+	cycleInterval = durationFlag(10 * time.Second)
+
+	tests := []struct {
+		backoff  time.Duration
+		attempt  int
+		min, max time.Duration
+	}{
+		{200 * time.Millisecond, 1, 100 * time.Millisecond, 200 * time.Millisecond},
+		{200 * time.Millisecond, 2, 200 * time.Millisecond, 400 * time.Millisecond},
+		{200 * time.Millisecond, 4, 800 * time.Millisecond, 1600 * time.Millisecond},
+		{200 * time.Millisecond, 10, 5 * time.Second, 10 * time.Second},
+		{200 * time.Millisecond, 100, 5 * time.Second, 10 * time.Second},
+		{time.Minute, 1, 5 * time.Second, 10 * time.Second},
+		{0, 5, 0, 0},
+	}
+	for _, test := range tests {
+		*retryBackoff = test.backoff
+		for i := 0; i < 20; i++ {
+			if d := retryDelay(test.attempt); d < test.min || d > test.max {
+				t.Errorf("retryDelay(%d) with a %v backoff = %v, expected between %v and %v",
+					test.attempt, test.backoff, d, test.min, test.max)
+				break
+			}
+		}
+	}
+}
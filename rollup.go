@@ -0,0 +1,52 @@
+/*
+ * rollup.go - cluster-wide totals of the cores monitored
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+// Return the totals of a cycle over every core monitored, under the "cluster"
+// instance: how many nodes answered, how many cores they host, and a few
+// top-line stats. Outside of cluster mode, nothing is returned when a single
+// core is monitored.
+func rollupValues(targets []*target) []Value {
+	var reachable, cores, numDocs, deletedDocs, sizeInBytes, mergeThreads, maxDeletedRatio float64
+	for _, t := range targets {
+		if len(t.statuses) > 0 {
+			reachable++
+		}
+
+		// Merge threads are counted from the node's thread dump, and the
+		// same for every core of a node.
+		nodeMergeThreads := 0
+		for _, status := range t.statuses {
+			cores++
+			numDocs += float64(status.NumDocs)
+			deletedDocs += float64(status.DeletedDocs)
+			sizeInBytes += float64(status.SizeInBytes)
+			if status.MaxDoc > 0 {
+				if ratio := float64(status.DeletedDocs) / float64(status.MaxDoc); ratio > maxDeletedRatio {
+					maxDeletedRatio = ratio
+				}
+			}
+			if status.MergeThreadCount > nodeMergeThreads {
+				nodeMergeThreads = status.MergeThreadCount
+			}
+		}
+		mergeThreads += float64(nodeMergeThreads)
+	}
+
+	if !*clusterMode && len(targets) < 2 && cores < 2 {
+		return nil
+	}
+	return []Value{
+		{Instance: "cluster", Type: "gauge", Name: "nodes_polled", Value: float64(len(targets))},
+		{Instance: "cluster", Type: "gauge", Name: "nodes_reachable", Value: reachable},
+		{Instance: "cluster", Type: "gauge", Name: "cores", Value: cores},
+		{Instance: "cluster", Type: "gauge", Name: "numdocs", Value: numDocs},
+		{Instance: "cluster", Type: "gauge", Name: "deleteddocs", Value: deletedDocs},
+		{Instance: "cluster", Type: "gauge", Name: "sizeinbytes", Value: sizeInBytes},
+		{Instance: "cluster", Type: "gauge", Name: "deleted_docs_ratio_max", Value: maxDeletedRatio},
+		{Instance: "cluster", Type: "gauge", Name: "mergethreadcount", Value: mergeThreads},
+	}
+}
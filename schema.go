@@ -0,0 +1,42 @@
+/*
+ * schema.go - schema API metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"net/url"
+)
+
+var schemaStats = flag.Bool("schema-stats", false, "collect field, dynamic field and copyField counts and a schema hash")
+
+// Collect the size of the schema of the specified core, as well as its
+// version and a hash of its content, which changes on every schema update.
+func getSchemaValues(t *target, core string) ([]Value, error) {
+	data, err := getParsedJson(fmt.Sprintf("%s/%s/schema?wt=json",
+		t.baseURL(),
+		url.PathEscape(core)))
+	if err != nil {
+		return nil, err
+	}
+
+	schema := data.S("schema")
+	if schema == nil {
+		return nil, fmt.Errorf("no schema could be found for the index '%s'", core)
+	}
+
+	values := []Value{
+		{Type: "gauge", Name: "schema_fields", Value: float64(len(schema.S("fields").Children()))},
+		{Type: "gauge", Name: "schema_dynamicfields", Value: float64(len(schema.S("dynamicFields").Children()))},
+		{Type: "gauge", Name: "schema_copyfields", Value: float64(len(schema.S("copyFields").Children()))},
+		{Type: "gauge", Name: "schema_hash", Value: float64(crc32.ChecksumIEEE(schema.Bytes()))},
+	}
+	if v, ok := schema.S("version").Data().(float64); ok {
+		values = append(values, Value{Type: "gauge", Name: "schema_version", Value: v})
+	}
+	return values, nil
+}
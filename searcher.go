@@ -0,0 +1,61 @@
+/*
+ * searcher.go - index searcher statistics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var searcherStats = flag.Bool("searcher-stats", false, "collect warmup time, size and age of the active searcher")
+
+// Collect the stats of the active searcher of the specified core, along with
+// how many searchers are currently registered (more than one while warming).
+func getSearcherValues(t *target, core string) ([]Value, error) {
+	registry, err := getCoreMetrics(t, core, "SEARCHER.searcher.")
+	if err != nil {
+		return nil, err
+	}
+
+	var values []Value
+	for _, f := range []struct{ key, name string }{
+		{"SEARCHER.searcher.warmupTime", "searcher_warmuptime"},
+		{"SEARCHER.searcher.maxDoc", "searcher_maxdoc"},
+		{"SEARCHER.searcher.numDocs", "searcher_numdocs"},
+	} {
+		if v, ok := registry.S(f.key).Data().(float64); ok {
+			values = append(values, Value{Type: "gauge", Name: f.name, Value: v})
+		}
+	}
+	if s, ok := registry.S("SEARCHER.searcher.openedAt").Data().(string); ok {
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			values = append(values, Value{Type: "gauge", Name: "searcher_age",
+				Value: time.Since(t).Truncate(time.Second).Seconds()})
+		}
+	}
+
+	// Every open searcher is listed by the mbeans handler as "Searcher@<id>...".
+	data, err := getParsedJson(fmt.Sprintf("%s/%s/admin/mbeans?cat=CORE&cat=SEARCHER&json.nl=map&wt=json",
+		t.baseURL(),
+		url.PathEscape(core)))
+	if err != nil {
+		return values, err
+	}
+	registered := 0
+	for _, category := range data.S("solr-mbeans").ChildrenMap() {
+		for name := range category.ChildrenMap() {
+			if strings.HasPrefix(name, "Searcher@") {
+				registered++
+			}
+		}
+	}
+	values = append(values, Value{Type: "gauge", Name: "searcher_registered", Value: float64(registered)})
+
+	return values, nil
+}
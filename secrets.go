@@ -0,0 +1,208 @@
+/*
+ * secrets.go - credentials read from files and secret managers
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jeffail/gabs"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+var credentialsRefresh = flag.Duration("credentials-refresh", time.Minute, "how often the credentials read from files and secret managers are read again, for rotated ones to be picked up")
+
+// A credential, given as such or as a reference to where it is read from:
+//
+//	file:/run/secrets/solr-password
+//	vault:secret/data/solr#password
+//	aws-sm:prod/solr#password
+//
+// References are read again every -credentials-refresh.
+type secret struct {
+	sync.Mutex
+	ref     string
+	value   string
+	readAt  time.Time
+	reading bool // a request is reading the reference again
+}
+
+// Set the credential, and read it if it is a reference.
+func (s *secret) load(ref string) error {
+	value, err := readSecret(ref)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	s.ref, s.value, s.readAt = ref, value, time.Now()
+	return nil
+}
+
+// Return the credential, read again if it is a reference read too long ago.
+// Only one request reads it, without holding the lock, while the others go on
+// with the value last read, as does that request should reading it fail.
+func (s *secret) get() string {
+	s.Lock()
+	ref, value := s.ref, s.value
+	refresh := secretRef(ref) && !s.reading && time.Since(s.readAt) >= *credentialsRefresh
+	s.reading = s.reading || refresh
+	s.Unlock()
+	if !refresh {
+		return value
+	}
+
+	newValue, err := readSecret(ref)
+
+	s.Lock()
+	defer s.Unlock()
+	s.reading, s.readAt = false, time.Now()
+	switch {
+	case s.ref != ref:
+		// Loaded again meanwhile, e.g. by a configuration reload.
+	case err != nil:
+		warnf("%v", err)
+	default:
+		if newValue != s.value {
+			infof("credentials changed in %s", ref)
+		}
+		s.value = newValue
+	}
+	return s.value
+}
+
+// Tell whether a credential is a reference, rather than the credential itself.
+func secretRef(ref string) bool {
+	for _, prefix := range []string{"file:", "vault:", "aws-sm:"} {
+		if strings.HasPrefix(ref, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the credential a reference points to, or the given credential.
+func readSecret(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "file:"):
+		b, err := ioutil.ReadFile(strings.TrimPrefix(ref, "file:"))
+		if err != nil {
+			return "", fmt.Errorf("cannot read credentials: %v", err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	case strings.HasPrefix(ref, "vault:"):
+		return readVaultSecret(strings.TrimPrefix(ref, "vault:"))
+	case strings.HasPrefix(ref, "aws-sm:"):
+		return readAWSSecret(strings.TrimPrefix(ref, "aws-sm:"))
+	}
+	return ref, nil
+}
+
+// Split a secret manager reference into the secret and its field, if any.
+func splitSecretRef(ref string) (string, string) {
+	if i := strings.LastIndex(ref, "#"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
+
+// Read a field of a secret from HashiCorp Vault, e.g. "secret/data/solr#password"
+// for a KV version 2 engine mounted at "secret". Vault is reached at
+// $VAULT_ADDR with $VAULT_TOKEN, or the token of ~/.vault-token.
+func readVaultSecret(ref string) (string, error) {
+	path, field := splitSecretRef(ref)
+	if field == "" {
+		return "", fmt.Errorf("invalid Vault secret '%s': expected path#field", ref)
+	}
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("cannot read Vault secret: VAULT_ADDR is not set")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		home, _ := os.UserHomeDir()
+		b, err := ioutil.ReadFile(filepath.Join(home, ".vault-token"))
+		if err != nil {
+			return "", fmt.Errorf("cannot read Vault secret: VAULT_TOKEN is not set, and %v", err)
+		}
+		token = strings.TrimSpace(string(b))
+	}
+
+	req, err := http.NewRequestWithContext(cycleContext, "GET",
+		strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot read Vault secret: %v", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	client := &http.Client{Timeout: httpTimeout()}
+	r, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("cannot read Vault secret: %v", err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cannot read Vault secret %s: got status code %d, expected 200", path, r.StatusCode)
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return "", fmt.Errorf("cannot read Vault reply: %v", err)
+	}
+	data, err := gabs.ParseJSON(body)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse Vault reply: %v", err)
+	}
+
+	// KV version 2 engines nest the secret in a second "data" object.
+	for _, c := range []*gabs.Container{data.S("data", "data", field), data.S("data", field)} {
+		if value, ok := c.Data().(string); ok {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("cannot read Vault secret %s: no string field '%s'", path, field)
+}
+
+// Read a secret from AWS Secrets Manager, e.g. "prod/solr#password" for a
+// field of a JSON secret, or "prod/solr-password" for a plain one. The usual
+// AWS credentials and region are used, from the environment, the shared
+// configuration files or the instance role.
+func readAWSSecret(ref string) (string, error) {
+	id, field := splitSecretRef(ref)
+	cfg, err := awsconfig.LoadDefaultConfig(cycleContext)
+	if err != nil {
+		return "", fmt.Errorf("cannot read AWS secret: %v", err)
+	}
+	cfg.HTTPClient = &http.Client{Timeout: httpTimeout()}
+
+	out, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(cycleContext,
+		&secretsmanager.GetSecretValueInput{SecretId: aws.String(id)})
+	if err != nil {
+		return "", fmt.Errorf("cannot read AWS secret: %v", err)
+	}
+	value := aws.ToString(out.SecretString)
+	if field == "" {
+		return value, nil
+	}
+
+	data, err := gabs.ParseJSON([]byte(value))
+	if err != nil {
+		return "", fmt.Errorf("cannot read AWS secret %s: not a JSON object: %v", id, err)
+	}
+	if v, ok := data.S(field).Data().(string); ok {
+		return v, nil
+	}
+	return "", fmt.Errorf("cannot read AWS secret %s: no string field '%s'", id, field)
+}
@@ -0,0 +1,110 @@
+/*
+ * secrets_test.go - tests of the credentials read from files
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSecretRefresh(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	if err := ioutil.WriteFile(path, []byte("first\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var s secret
+	if err := s.load("file:" + path); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.get(); got != "first" {
+		t.Fatalf("get() = %s, expected first", got)
+	}
+	if err := ioutil.WriteFile(path, []byte("second\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Not read again before -credentials-refresh.
+	if got := s.get(); got != "first" {
+		t.Errorf("get() = %s before the refresh, expected first", got)
+	}
+
+	// Nor while another request is reading it.
+	s.readAt = time.Now().Add(-2 * *credentialsRefresh)
+	s.reading = true
+	if got := s.get(); got != "first" {
+		t.Errorf("get() = %s during another refresh, expected first", got)
+	}
+
+	s.reading = false
+	if got := s.get(); got != "second" {
+		t.Errorf("get() = %s after the refresh, expected second", got)
+	}
+
+	// Should reading fail, the last value is kept.
+	s.ref = "file:" + filepath.Join(filepath.Dir(path), "missing")
+	s.readAt = time.Time{}
+	if got := s.get(); got != "second" {
+		t.Errorf("get() = %s after a failed refresh, expected second", got)
+	}
+	if s.reading {
+		t.Errorf("still reading after the refresh")
+	}
+}
+
+func TestSecretReferences(t *testing.T) {
+	tests := []struct {
+		ref           string
+		isRef         bool
+		secret, field string
+	}{
+		{"s3cret", false, "s3cret", ""},
+		{"", false, "", ""},
+		{"File:/run/secrets/password", false, "File:/run/secrets/password", ""},
+		{"file:/run/secrets/password", true, "file:/run/secrets/password", ""},
+		{"vault:secret/data/solr#password", true, "vault:secret/data/solr", "password"},
+		{"aws-sm:prod/solr#password", true, "aws-sm:prod/solr", "password"},
+		{"aws-sm:prod/solr-password", true, "aws-sm:prod/solr-password", ""},
+		{"vault:secret/data/a#b#password", true, "vault:secret/data/a#b", "password"},
+	}
+	for _, test := range tests {
+		if got := secretRef(test.ref); got != test.isRef {
+			t.Errorf("secretRef(%s) = %v, expected %v", test.ref, got, test.isRef)
+		}
+		if secret, field := splitSecretRef(test.ref); secret != test.secret || field != test.field {
+			t.Errorf("splitSecretRef(%s) = %s, %s, expected %s, %s", test.ref, secret, field, test.secret, test.field)
+		}
+	}
+}
+
+func TestReadSecret(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"plain": "s3cret", "newline": "s3cret\n", "crlf": "s3cret\r\n", "spaces": " s3cret \n"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		ref, expected string
+		valid         bool
+	}{
+		{"s3cret", "s3cret", true},
+		{"file:" + filepath.Join(dir, "plain"), "s3cret", true},
+		{"file:" + filepath.Join(dir, "newline"), "s3cret", true},
+		{"file:" + filepath.Join(dir, "crlf"), "s3cret", true},
+		{"file:" + filepath.Join(dir, "spaces"), " s3cret ", true},
+		{"file:" + filepath.Join(dir, "missing"), "", false},
+		{"vault:secret/data/solr", "", false},
+	}
+	for _, test := range tests {
+		got, err := readSecret(test.ref)
+		if got != test.expected || (err == nil) != test.valid {
+			t.Errorf("readSecret(%s) = %q, %v, expected %q", test.ref, got, err, test.expected)
+		}
+	}
+}
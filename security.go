@@ -0,0 +1,62 @@
+/*
+ * security.go - authentication and authorization failure metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"strings"
+)
+
+var securityStats = flag.Bool("security-stats", false, "collect authentication and authorization failure counts, when security is enabled")
+
+// Metrics of the node's security plugins, as named in the metrics API.
+var securityMetrics = []struct {
+	key  string
+	name string
+}{
+	{"SECURITY./authentication.requests", "auth_requests"},
+	{"SECURITY./authentication.authenticated", "auth_authenticated"},
+	{"SECURITY./authentication.passThrough", "auth_passthrough"},
+	{"SECURITY./authentication.failWrongCredentials", "auth_fail_wrong_credentials"},
+	{"SECURITY./authentication.failInvalidCredentials", "auth_fail_invalid_credentials"},
+	{"SECURITY./authentication.failMissingCredentials", "auth_fail_missing_credentials"},
+	{"SECURITY./authentication.errors", "auth_errors"},
+	{"SECURITY./authorization.requests", "authz_requests"},
+	{"SECURITY./authorization.authorized", "authz_authorized"},
+	{"SECURITY./authorization.denied", "authz_denied"},
+	{"SECURITY./authorization.errors", "authz_errors"},
+}
+
+// Collect the request and failure counts of the authentication and
+// authorization plugins. Nothing is reported when security is disabled,
+// as Solr then does not register these metrics.
+func getSecurityValues(t *target, core string) ([]Value, error) {
+	registries, err := getMetrics(t, "node", "SECURITY./")
+	if err != nil {
+		return nil, err
+	}
+	registry := registries.S("solr.node")
+
+	var values []Value
+	var failures float64
+	var hasFailures bool
+	for _, m := range securityMetrics {
+		v, ok := metricCount(registry.S(m.key))
+		if !ok {
+			continue
+		}
+		values = append(values, Value{Type: "derive", Name: m.name, Value: v})
+		if strings.Contains(m.key, ".fail") {
+			failures += v
+			hasFailures = true
+		}
+	}
+
+	if hasFailures {
+		values = append(values, Value{Type: "derive", Name: "auth_failures", Value: failures})
+	}
+	return values, nil
+}
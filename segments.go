@@ -0,0 +1,58 @@
+/*
+ * segments.go - segments API aggregates
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+)
+
+var segmentStats = flag.Bool("segment-stats", false, "collect segment size, deletion and merge candidate aggregates from the segments API")
+
+// Collect aggregates over the segments of the specified core.
+func getSegmentValues(t *target, core string) ([]Value, error) {
+	data, err := getParsedJson(fmt.Sprintf("%s/%s/admin/segments?wt=json",
+		t.baseURL(),
+		url.PathEscape(core)))
+	if err != nil {
+		return nil, err
+	}
+
+	segments := data.S("segments")
+	if segments == nil {
+		return nil, fmt.Errorf("no segments could be found for the index '%s'", core)
+	}
+
+	var largest, deletedBytes float64
+	var withDeletes, mergeCandidates int
+	for _, segment := range segments.ChildrenMap() {
+		sizeInBytes, _ := segment.S("sizeInBytes").Data().(float64)
+		maxDoc, _ := segment.S("size").Data().(float64)
+		delCount, _ := segment.S("delCount").Data().(float64)
+
+		if sizeInBytes > largest {
+			largest = sizeInBytes
+		}
+		if delCount > 0 {
+			withDeletes++
+			// Assume deleted documents take as much space as live ones.
+			if maxDoc > 0 {
+				deletedBytes += sizeInBytes * delCount / maxDoc
+			}
+		}
+		if boolValue(segment.S("mergeCandidate")) == 1 {
+			mergeCandidates++
+		}
+	}
+
+	return []Value{
+		{Type: "gauge", Name: "segments_largest_bytes", Value: largest},
+		{Type: "gauge", Name: "segments_with_deletes", Value: float64(withDeletes)},
+		{Type: "gauge", Name: "segments_deleted_bytes", Value: float64(int64(deletedBytes))},
+		{Type: "gauge", Name: "segments_merge_candidates", Value: float64(mergeCandidates)},
+	}, nil
+}
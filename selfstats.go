@@ -0,0 +1,121 @@
+/*
+ * selfstats.go - health of the plugin itself
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var selfStats = flag.Bool("self-stats", false, "report the plugin's own health: request time and errors per endpoint, cycle duration, consecutive failures and last success")
+
+// What happened to the requests made to an endpoint since the start.
+type endpointStats struct {
+	requests    int64
+	httpErrors  int64
+	parseErrors int64
+	time        time.Duration
+}
+
+var (
+	endpointMutex sync.Mutex
+	endpoints     = make(map[string]*endpointStats)
+)
+
+// Record a request to the given URL, and how it failed if it did ("http" or
+// "parse").
+func recordRequest(rawurl string, d time.Duration, failure string) {
+	name := endpointName(rawurl)
+
+	endpointMutex.Lock()
+	defer endpointMutex.Unlock()
+	e := endpoints[name]
+	if e == nil {
+		e = &endpointStats{}
+		endpoints[name] = e
+	}
+	e.requests++
+	e.time += d
+	switch failure {
+	case "http":
+		e.httpErrors++
+	case "parse":
+		e.parseErrors++
+	}
+}
+
+// Return the endpoint a URL belongs to, e.g. "admin_cores_status" for a
+// CoreAdmin STATUS, or "admin_luke" for the Luke handler of any core.
+func endpointName(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "unknown"
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(u.Path, solrPath()), "/"), "/")
+	// The core name is not part of the endpoint.
+	if len(parts) > 1 && parts[0] != "admin" {
+		parts = parts[1:]
+	}
+	if action := u.Query().Get("action"); action != "" {
+		parts = append(parts, strings.ToLower(action))
+	}
+	return metricName(strings.Join(parts, "_"))
+}
+
+// Return the values about the requests made to every endpoint, and how long
+// the last cycle took.
+func selfValues(cycle time.Duration) []Value {
+	if !*selfStats {
+		return nil
+	}
+	values := []Value{{Instance: "self", Type: "gauge", Name: "cycle_duration", Value: float64(cycle.Milliseconds())}}
+
+	endpointMutex.Lock()
+	defer endpointMutex.Unlock()
+	names := make([]string, 0, len(endpoints))
+	for name := range endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		e := endpoints[name]
+		values = append(values,
+			Value{Instance: "self", Type: "derive", Name: "requests_" + name, Value: float64(e.requests)},
+			Value{Instance: "self", Type: "derive", Name: "request_time_" + name, Value: float64(e.time.Milliseconds())},
+			Value{Instance: "self", Type: "derive", Name: "http_errors_" + name, Value: float64(e.httpErrors)},
+			Value{Instance: "self", Type: "derive", Name: "parse_errors_" + name, Value: float64(e.parseErrors)})
+	}
+	return values
+}
+
+// Count the cycles in a row the target failed on, and remember when it last
+// succeeded.
+func (t *target) recordCycle(now time.Time) {
+	if t.failed {
+		t.failures++
+	} else {
+		t.failures, t.lastSuccess = 0, now
+	}
+}
+
+// Return the values about how the last cycles went on the target.
+func (t *target) selfValues() []Value {
+	if !*selfStats {
+		return nil
+	}
+	var lastSuccess float64
+	if !t.lastSuccess.IsZero() {
+		lastSuccess = float64(t.lastSuccess.Unix())
+	}
+	return []Value{
+		{Instance: "self", Type: "gauge", Name: "consecutive_failures", Value: float64(t.failures)},
+		{Instance: "self", Type: "gauge", Name: "last_success", Value: lastSuccess},
+	}
+}
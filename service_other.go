@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+/*
+ * service_other.go - services are only supported on Windows
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func serviceCommand(args []string) error {
+	return fmt.Errorf("services are only supported on Windows: use systemd or another supervisor instead")
+}
+
+func startService(stop chan<- os.Signal) error {
+	return nil
+}
+
+func stopService() {}
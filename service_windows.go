@@ -0,0 +1,156 @@
+/*
+ * service_windows.go - running as a Windows service
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const serviceName = "solr-status"
+
+// Closed when the service has been told to stop, and once it reported it did.
+var serviceDone, serviceStopped chan bool
+
+// Install or uninstall the service. The flags given on install are those the
+// service runs with.
+func serviceCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: solr-status service install [flags] | uninstall")
+	}
+	switch args[0] {
+	case "install":
+		return installService(args[1:])
+	case "uninstall":
+		return uninstallService()
+	}
+	return fmt.Errorf("unknown service command '%s': expected install or uninstall", args[0])
+}
+
+// Register the service with the service manager, along with its event log
+// source.
+func installService(args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot find the executable: %v", err)
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("cannot connect to the service manager: %v", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: "Solr status",
+		Description: "Polls Solr servers and writes their status values.",
+		StartType:   mgr.StartAutomatic,
+	}, args...)
+	if err != nil {
+		return fmt.Errorf("cannot install the service: %v", err)
+	}
+	defer s.Close()
+
+	if err := eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		s.Delete()
+		return fmt.Errorf("cannot install the event log source: %v", err)
+	}
+	return nil
+}
+
+// Remove the service and its event log source.
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("cannot connect to the service manager: %v", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("cannot find the service: %v", err)
+	}
+	defer s.Close()
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("cannot uninstall the service: %v", err)
+	}
+	eventlog.Remove(serviceName)
+	return nil
+}
+
+// When started by the service manager, log to the event log and send stop
+// requests to the given channel, as SIGTERM would.
+func startService(stop chan<- os.Signal) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return err
+	}
+
+	elog, err := eventlog.Open(serviceName)
+	if err != nil {
+		return fmt.Errorf("cannot open the event log: %v", err)
+	}
+	eventLogger = func(level int, msg string) {
+		switch logLevels[level] {
+		case "error":
+			elog.Error(1, msg)
+		case "warn":
+			elog.Warning(1, msg)
+		default:
+			elog.Info(1, msg)
+		}
+	}
+
+	serviceDone, serviceStopped = make(chan bool), make(chan bool)
+	go func() {
+		if err := svc.Run(serviceName, &service{stop: stop}); err != nil {
+			elog.Error(1, fmt.Sprintf("cannot run the service: %v", err))
+		}
+		close(serviceStopped)
+	}()
+	return nil
+}
+
+// Tell the service manager the service stopped, when running as one.
+func stopService() {
+	if serviceDone == nil {
+		return
+	}
+	close(serviceDone)
+	<-serviceStopped
+}
+
+// The handler of the service manager requests.
+type service struct {
+	stop chan<- os.Signal
+}
+
+func (s *service) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown
+	status <- svc.Status{State: svc.Running, Accepts: accepted}
+
+	for {
+		select {
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				status <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				select {
+				case s.stop <- syscall.SIGTERM:
+				default: // already stopping
+				}
+			}
+		case <-serviceDone:
+			return false, 0
+		}
+	}
+}
@@ -8,102 +8,717 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/Jeffail/gabs"
 )
 
 const defaultIntervalSecs = 20
-const httpTimeoutSecs = 5
-const pluginName = "solr_status"
+const defaultTimeoutSecs = 5
+const defaultPluginName = "solr_status"
 
 type SolrStatus struct {
 	NumDocs          int
+	MaxDoc           int
 	DeletedDocs      int
 	SegmentCount     int
 	SizeInBytes      int
 	MergeThreadCount int
+	ForceMerge       bool
+	LastModified     time.Time
+	StartTime        time.Time
+	Uptime           time.Duration
+	Threads          threadCounts
+}
+
+// A single value, identified the way collectd expects it.
+type Value struct {
+	Instance string // plugin instance, may be empty
+	Type     string // collectd type, e.g. "gauge"
+	Name     string // type instance, e.g. "numdocs"
+	Value    float64
+	Interval time.Duration     // time between values if not the plugin interval, or 0
+	Labels   map[string]string // static labels, e.g. env=prod
 }
 
 var (
-	solrServer = flag.String("server", "", "the solr server we need to poll")
-	coreName   = flag.String("core", "", "the core name we want to get data from")
-	useHTTPS   = flag.Bool("https", false, "use HTTPS while connecting to the solr server")
+	useHTTPS      = flag.Bool("https", false, "use HTTPS while connecting to the solr server")
+	contextRoot   = flag.String("context-root", "/solr", "path Solr is served under, e.g. \"/search/solr\" behind a reverse proxy")
+	showVer       = flag.Bool("version", false, "print the version and exit")
+	once          = flag.Bool("once", false, "run a single collection cycle and exit, with a non-zero status if anything could not be collected")
+	timeoutSecs   = flag.Int("timeout", defaultTimeoutSecs, "timeout in seconds of every HTTP request, to be raised for slow admin endpoints on large indexes")
+	hostName      = flag.String("hostname", "", "collectd hostname of the values, instead of COLLECTD_HOSTNAME or the name of the machine")
+	hostFormat    = flag.String("hostname-format", "", "how the name of the machine is reported when neither -hostname nor COLLECTD_HOSTNAME is given: short, fqdn, or reverse for the reverse DNS name of its address (as is if empty)")
+	outputFile    = flag.String("output", "", "append the values to this file instead of writing them to stdout, e.g. when running as a service")
+	pluginName    = flag.String("plugin", defaultPluginName, "collectd plugin name the values are reported under, e.g. \"solr_status_search\"")
+	serverNames   listFlag
+	coreNames     listFlag
+	cycleInterval durationFlag
 )
 
+// Where values are written.
+var output io.Writer = os.Stdout
+
+func init() {
+	flag.Var(&serverNames, "server", "the solr server we need to poll (comma-separated or repeated for several servers)")
+	flag.Var(&coreNames, "core", "the core name we want to get data from (comma-separated or repeated for several cores, every core if omitted)")
+	flag.Var(&cycleInterval, "interval", "time between collection cycles, in seconds or as a duration such as \"500ms\" or \"2m\", instead of COLLECTD_INTERVAL (20s by default)")
+}
+
+// A list flag, given as a comma-separated list and/or by repeating the flag.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(s string) error {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// A duration flag, given in seconds or as a duration, e.g. "20" or "1m30s".
+type durationFlag time.Duration
+
+func (d *durationFlag) String() string {
+	return time.Duration(*d).String()
+}
+
+func (d *durationFlag) Set(s string) error {
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		*d = durationFlag(secs * float64(time.Second))
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("expected seconds or a duration such as \"500ms\" or \"2m\"")
+	}
+	*d = durationFlag(v)
+	return nil
+}
+
 func main() {
 
+	// Handle subcommands.
+	if len(os.Args) > 1 && os.Args[1] == "self-update" {
+		if err := parseFlags(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := selfUpdate(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := configCommand(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "service" {
+		if err := serviceCommand(os.Args[2:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// On SIGTERM or SIGINT, or when the service is stopped, let the cycle in
+	// progress write its values, then exit.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	if err := startService(stop); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
 	// Process parameters.
-	flag.Parse()
-	if *solrServer == "" {
-		fmt.Println("no solr server specified. Exiting.")
+	if err := parseFlags(os.Args[1:]); err != nil {
+		fmt.Println(err)
 		os.Exit(1)
 	}
-	if *coreName == "" {
-		fmt.Println("no core name specified. Exiting.")
+	if *showVer {
+		fmt.Println("solr-status", version)
+		os.Exit(0)
+	}
+	if err := setupLogging(); err != nil {
+		fmt.Println(err)
 		os.Exit(1)
 	}
-
-	// get hostname from ENV.
-	hostname := os.Getenv("COLLECTD_HOSTNAME")
-	if len(hostname) == 0 {
-		hostname = "localhost"
+	targets, discover, err := setupTargets()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if *outputFile != "" {
+		f, err := os.OpenFile(*outputFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		output = f
 	}
 
-	// Get check interval from ENV.
-	interval, err := strconv.ParseInt(os.Getenv("COLLECTD_INTERVAL"), 10, 32)
+	hostname := localHostname()
+
+	// Keep a history of the collected data if periodic reports are enabled.
+	period, err := getReportPeriod()
 	if err != nil {
-		interval = defaultIntervalSecs
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	var hist *history
+	if period > 0 {
+		if *reportWebhook == "" && *reportSMTP == "" {
+			fmt.Println("no report webhook or SMTP server specified. Exiting.")
+			os.Exit(1)
+		}
+		if *reportSMTP != "" && *reportTo == "" {
+			fmt.Println("no report recipients specified. Exiting.")
+			os.Exit(1)
+		}
+		hist = newHistory(period)
+		go runReports(hist, hostname, period)
 	}
 
-	// Fetch data from the specified server/core.
-	var status SolrStatus
+	setMemoryLimit()
+	if *checkUpdates {
+		go runUpdateChecks()
+	}
 
+	if err := startHealthServer(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := writePidFile(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// Reload the configuration file on SIGHUP.
+	reload := make(chan os.Signal, 1)
+	if *configFile != "" {
+		signal.Notify(reload, syscall.SIGHUP)
+	}
+
+	// Do not start polling at the same second as the rest of the fleet.
+	if !*dryRun {
+		select {
+		case sig := <-stop:
+			shutdown(sig)
+		case <-time.After(startJitterDelay()):
+		}
+	}
+
+	// Fetch data from the specified servers/cores.
+	seeds := targets
+	var clusterTargets, replicaTargets []*target
+	var replicas []replica
+	discovered := make(map[string]*target)
+	clusterKnown := make(map[string]*target)
+	known := make(map[string]*target)
+
+	// Start cycles on the ticks of a ticker, so that they do not drift as the
+	// collection takes more or less time. Should a cycle take longer than the
+	// interval, the ticks missed are skipped.
+	interval := pollInterval()
+	ticker := time.NewTicker(interval)
+	start := time.Now()
 	for {
-		err := getStatus(*coreName, &status)
+		select {
+		case <-reload:
+			if t, d, err := reloadConfig(); err != nil {
+				errorf("cannot reload configuration: %v", err)
+			} else {
+				seeds, discover = t, d
+				hostname = localHostname()
+				infof("configuration reloaded")
+			}
+			if i := pollInterval(); i != interval {
+				interval = i
+				ticker.Reset(interval)
+			}
+		default:
+		}
+
+		overMemory := enforceMemoryCeiling(hist)
+		startDumpCycle(start)
+		endCycle := startCycle(start)
+		failed := false
+
+		// Poll the discovered servers, if any. Should discovery fail, keep
+		// polling the last ones.
+		if discover != nil {
+			if t, err := discover(discovered); err != nil {
+				warnf("%v", err)
+				failed = true
+			} else {
+				seeds = t
+			}
+		}
+		targets = seeds
+
+		// In cluster mode, poll every live node of the cluster.
+		if *clusterMode {
+			if t, err := discoverClusterTargets(seeds, clusterKnown); err != nil {
+				warnf("%v", err)
+				failed = true
+			} else {
+				clusterTargets = t
+			}
+			targets = clusterTargets
+		}
+
+		// In collection mode, follow the replicas wherever they are. Should
+		// they not be resolved, keep polling the last ones.
+		if len(collectionNames) > 0 {
+			if t, r, err := resolveCollections(seeds, known); err != nil {
+				warnf("%v", err)
+				failed = true
+			} else {
+				replicaTargets, replicas = t, r
+			}
+			targets = replicaTargets
+		}
+
+		now := start
+		for i, values := range pollAll(targets, hist, overMemory) {
+			host := hostname
+			if targets[i].host != "" {
+				host = targets[i].host
+			}
+			labels := targets[i].valueLabels()
+			for _, v := range values {
+				v.Labels = labels
+				putval(host, now, v)
+			}
+		}
+		pruneSegmentTrajectories(targets)
+		for _, v := range rollupValues(targets) {
+			putval(hostname, now, v)
+		}
+
+		for _, v := range collectionValues(replicas) {
+			putval(hostname, now, v)
+		}
+		for _, v := range memoryValues() {
+			putval(hostname, now, v)
+		}
+		for _, v := range updateValues() {
+			putval(hostname, now, v)
+		}
+		for _, v := range selfValues(time.Since(start)) {
+			putval(hostname, now, v)
+		}
+		endCycle()
+
+		// Tell whether everything could be collected, and exit in one-shot mode.
+		for _, t := range targets {
+			failed = failed || t.failed
+		}
+		failed = failed || len(targets) == 0
+		recordHealth(!failed)
+		notifyCycle(!failed)
+		if *once || *dryRun {
+			if *dryRun {
+				printDryRun(targets)
+			}
+			if failed {
+				os.Exit(1)
+			}
+			return
+		}
+
+		select {
+		case sig := <-stop:
+			shutdown(sig)
+		case start = <-ticker.C:
+		}
+	}
+}
+
+// Exit cleanly, between cycles so that no value is left half written.
+func shutdown(sig os.Signal) {
+	infof("received %v, exiting", sig)
+	if logRotator != nil {
+		logRotator.Close()
+	}
+	removePidFile()
+	stopService()
+	os.Exit(0)
+}
+
+// Build the targets to poll, and how to discover more, from the flags.
+func setupTargets() ([]*target, func(map[string]*target) ([]*target, error), error) {
+	if *serverPort < 0 || *serverPort > 65535 {
+		return nil, nil, fmt.Errorf("the port must be a number between 1 and 65535")
+	}
+	if err := compileHeaders(); err != nil {
+		return nil, nil, err
+	}
+	targets, err := getTargets()
+	if err != nil {
+		return nil, nil, err
+	}
+	discover := serverDiscovery(targets)
+	if len(targets) == 0 && discover == nil {
+		return nil, nil, fmt.Errorf("no solr server specified")
+	}
+	if err := compileCoreFilters(); err != nil {
+		return nil, nil, err
+	}
+	if err := compileMetricFilters(); err != nil {
+		return nil, nil, err
+	}
+	if cycleInterval < 0 {
+		return nil, nil, fmt.Errorf("the interval cannot be negative")
+	}
+	if startJitter < 0 || targetSpread < 0 {
+		return nil, nil, fmt.Errorf("the start jitter and target spread cannot be negative")
+	}
+	if *healthCycles < 1 {
+		return nil, nil, fmt.Errorf("the number of health cycles must be at least 1")
+	}
+	if *debugDumpCycles < 0 {
+		return nil, nil, fmt.Errorf("the number of dumped cycles cannot be negative")
+	}
+	if *timeoutSecs < 1 {
+		return nil, nil, fmt.Errorf("the timeout must be at least 1 second")
+	}
+	if *dialTimeout < 0 || *tlsTimeout < 0 || *responseTimeout < 0 || *cycleTimeout < 0 {
+		return nil, nil, fmt.Errorf("the dial, TLS, response and cycle timeouts must be positive")
+	}
+	if *maxRate < 0 {
+		return nil, nil, fmt.Errorf("the maximum request rate must be positive")
+	}
+	if *idleConns < 0 || *idleTimeout < 0 {
+		return nil, nil, fmt.Errorf("the idle connections and their timeout must be positive")
+	}
+	if *breakerFailures < 0 || *breakerCooldown < 0 {
+		return nil, nil, fmt.Errorf("the circuit breaker failures and cooldown must be positive")
+	}
+	if *maxAttempts < 1 || *retryBackoff < 0 {
+		return nil, nil, fmt.Errorf("requests must be attempted at least once, with a positive backoff")
+	}
+	if err := checkMode(); err != nil {
+		return nil, nil, err
+	}
+	if err := loadCredentials(); err != nil {
+		return nil, nil, err
+	}
+	if err := loadTLS(); err != nil {
+		return nil, nil, err
+	}
+	if err := loadProxy(); err != nil {
+		return nil, nil, err
+	}
+	if err := loadSolrTimezone(); err != nil {
+		return nil, nil, err
+	}
+	if err := compileLabels(); err != nil {
+		return nil, nil, err
+	}
+	if err := compileCollectorIntervals(); err != nil {
+		return nil, nil, err
+	}
+	if *concurrency < 1 {
+		return nil, nil, fmt.Errorf("the concurrency must be at least 1")
+	}
+	if *hostFormat != "" && *hostFormat != "short" && *hostFormat != "fqdn" && *hostFormat != "reverse" {
+		return nil, nil, fmt.Errorf("invalid hostname format '%s': expected short, fqdn or reverse", *hostFormat)
+	}
+	if strings.ContainsAny(*hostName, "/ ") {
+		return nil, nil, fmt.Errorf("invalid hostname '%s': it cannot contain '/' or spaces", *hostName)
+	}
+	if *pluginName == "" || strings.ContainsAny(*pluginName, "-/ ") {
+		return nil, nil, fmt.Errorf("invalid plugin name '%s': it cannot be empty or contain '-', '/' or spaces", *pluginName)
+	}
+	return targets, discover, nil
+}
+
+// Poll the targets, up to -concurrency at a time and each at its phase offset,
+// and return their values in the same order.
+func pollAll(targets []*target, hist *history, overMemory bool) [][]Value {
+	results := make([][]Value, len(targets))
+	slots := make(chan bool, *concurrency)
+	var wg sync.WaitGroup
+
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t *target) {
+			defer wg.Done()
+			time.Sleep(t.phaseOffset())
+			slots <- true
+			results[i] = poll(t, hist, overMemory)
+			<-slots
+		}(i, t)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// Run a collection cycle for every core of the target, followed by the
+// node-wide collectors.
+func poll(t *target, hist *history, overMemory bool) []Value {
+	var values []Value
+
+	if t.circuitOpen(time.Now()) {
+		t.polled, t.failed = nil, true
+		return append(t.breakerValues(time.Now()), t.selfValues()...)
+	}
+
+	// Tell which of the fallback servers served the data.
+	if t.failover != nil {
+		values = append(values, Value{Type: "gauge", Name: "failover_index", Value: float64(t.failOver())})
+	}
+
+	// Without any core specified, monitor whatever cores the server has now.
+	cores := coreNames
+	if t.cores != nil {
+		cores = t.cores
+	} else if len(cores) == 0 {
+		cores = t.discoveredCores()
+	}
+	t.polled = cores
+	t.failed = len(cores) == 0
+	for core := range t.statuses {
+		if !contains(cores, core) {
+			delete(t.statuses, core)
+		}
+	}
+
+	// With several cores, fetch their status and the thread dump only once.
+	// Should that fail, every core fetches its own.
+	if len(cores) > 1 {
+		t.coresStatus, _ = getParsedJson(t.baseURL() + "/admin/cores?action=STATUS&wt=json")
+		t.threadDump, _ = getParsedJson(t.baseURL() + "/admin/info/threads")
+		defer func() {
+			t.coresStatus, t.threadDump = nil, nil
+		}()
+	}
+
+	reachable := false
+	for _, core := range cores {
+		if t.statuses[core] == nil {
+			t.statuses[core] = &SolrStatus{}
+		}
+		v, err := collect(t, core, t.statuses[core], overMemory)
+		if hist != nil {
+			hist.record(t.coreLabel(core), t.statuses[core], err)
+		}
 		if err != nil {
-			log.Println(err)
-			time.Sleep(time.Second * time.Duration(interval))
+			errorf("%v", err)
+			t.failed = true
+			delete(t.statuses, core)
+			if _, ok := err.(coreNotFoundError); ok {
+				t.coreMissing = true
+			}
+		} else {
+			reachable = true
+		}
+		if len(coreNames) != 1 {
+			v = coreValues(core, v)
+		}
+		values = append(values, v...)
+	}
+	if reachable {
+		// Threads may be caught forcing a merge without telling on which core.
+		values = append(values, Value{Type: "gauge", Name: "forcemerge_threads", Value: float64(t.forceMergeThreads)})
+		values = append(values, runCollectors(nodeCollectors, t, cores[0], overMemory)...)
+	}
+	t.recordCycle(time.Now())
+	t.tripBreaker(time.Now())
+	values = append(values, t.breakerValues(time.Now())...)
+	values = append(values, t.selfValues()...)
+
+	return values
+}
+
+// Run a collection cycle for the specified core. If the core status cannot be
+// fetched, only the probe values are returned, along with the error. Node-wide
+// collectors are not run here, as they are shared by all the cores.
+func collect(t *target, core string, status *SolrStatus, overMemory bool) ([]Value, error) {
+	var values []Value
+
+	// Probe first, so that availability is reported even when Solr is down.
+	if *pingProbe {
+		v, err := getPingValues(t, core)
+		if err != nil {
+			warnf("ping: %v", err)
+		}
+		values = append(values, v...)
+	}
+
+	if err := getStatus(t, core, status); err != nil {
+		return values, err
+	}
+	values = append(values, status.values()...)
+	values = append(values, runCollectors(coreCollectors, t, core, overMemory)...)
+
+	return values, nil
+}
+
+// Gather the values of the enabled collectors.
+func runCollectors(collectors []collector, t *target, core string, overMemory bool) []Value {
+	var values []Value
+
+	for _, c := range collectors {
+		if !*c.enabled {
+			continue
+		}
+		if c.heavy && overMemory {
+			atomic.AddInt64(&shedCollectors, 1)
+			continue
+		}
+		if !t.collectorDue(c, core) {
 			continue
 		}
+		// Keep whatever was collected, even if incomplete.
+		v, err := c.collect(t, core)
+		if err != nil {
+			warnf("%s collector: %v", c.name, err)
+		}
+		// Tell collectd these values come less often than the others.
+		if every, ok := collectorIntervals[c.name]; ok {
+			for i := range v {
+				v[i].Interval = every
+			}
+		}
+		values = append(values, v...)
+	}
+
+	return values
+}
+
+// Move the values of a core to their own plugin instance, so that several
+// cores can be told apart. Values which already have one are left alone.
+func coreValues(core string, values []Value) []Value {
+	for i := range values {
+		if values[i].Instance == "" {
+			values[i].Instance = "core." + metricName(core)
+		}
+	}
+	return values
+}
+
+// Return whether the list contains the given string.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Write a value to stdout using the collectd exec plugin protocol.
+func putval(hostname string, now time.Time, v Value) {
+	plugin := *pluginName
+	if v.Labels == nil {
+		v.Labels = globalLabels
+	}
+	if instance := labelInstance(v.Labels, v.Instance); instance != "" {
+		plugin += "-" + instance
+	}
+	id := fmt.Sprintf("%s/%s-%s", plugin, v.Type, v.Name)
+	if !metricAllowed(id) {
+		return
+	}
 
-		// Use os.Stdout so that the output is not buffered.
-		now := time.Now().Unix()
-		fmt.Fprintf(os.Stdout, "PUTVAL %s/%s/gauge-numdocs %d:%d\n",
-			hostname,
-			pluginName,
-			now,
-			status.NumDocs)
-		fmt.Fprintf(os.Stdout, "PUTVAL %s/%s/gauge-deleteddocs %d:%d\n",
-			hostname,
-			pluginName,
-			now,
-			status.DeletedDocs)
-		fmt.Fprintf(os.Stdout, "PUTVAL %s/%s/gauge-segmentcount %d:%d\n",
-			hostname,
-			pluginName,
-			now,
-			status.SegmentCount)
-		fmt.Fprintf(os.Stdout, "PUTVAL %s/%s/gauge-sizeinbytes %d:%d\n",
-			hostname,
-			pluginName,
-			now,
-			status.SizeInBytes)
-
-		fmt.Fprintf(os.Stdout, "PUTVAL %s/%s/gauge-mergethreadcount %d:%d\n",
-			hostname,
-			pluginName,
-			now,
-			status.MergeThreadCount)
-
-		time.Sleep(time.Second * time.Duration(interval))
+	// Values come at the plugin interval unless told otherwise.
+	var options string
+	if v.Interval != 0 {
+		options = " interval=" + seconds(v.Interval)
+	} else if cycleInterval > 0 {
+		options = " interval=" + seconds(time.Duration(cycleInterval))
 	}
+
+	// Below a second, timestamps need their fractional part.
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	if pollInterval()%time.Second != 0 {
+		timestamp = strconv.FormatFloat(float64(now.UnixNano())/1e9, 'f', 3, 64)
+	}
+
+	command := "PUTVAL"
+	if *dryRun {
+		command = "would emit"
+	}
+
+	// Use an unbuffered output, so that values are not held back.
+	fmt.Fprintf(output, "%s %s/%s%s %s:%s\n",
+		command,
+		hostname,
+		id,
+		options,
+		timestamp,
+		strconv.FormatFloat(v.Value, 'f', -1, 64))
+}
+
+// Return the core status as values.
+func (status *SolrStatus) values() []Value {
+	values := []Value{
+		{Type: "gauge", Name: "numdocs", Value: float64(status.NumDocs)},
+		{Type: "gauge", Name: "deleteddocs", Value: float64(status.DeletedDocs)},
+		{Type: "gauge", Name: "segmentcount", Value: float64(status.SegmentCount)},
+		{Type: "gauge", Name: "sizeinbytes", Value: float64(status.SizeInBytes)},
+		{Type: "gauge", Name: "mergethreadcount", Value: float64(status.MergeThreadCount)},
+	}
+
+	forceMerge := 0.0
+	if status.ForceMerge {
+		forceMerge = 1
+	}
+	values = append(values, Value{Type: "gauge", Name: "forcemerge_running", Value: forceMerge})
+
+	if status.MaxDoc > 0 {
+		values = append(values, Value{Type: "gauge", Name: "deleted_docs_ratio",
+			Value: float64(status.DeletedDocs) / float64(status.MaxDoc)})
+	}
+
+	// An empty index has never been modified.
+	if !status.LastModified.IsZero() {
+		values = append(values, Value{Type: "gauge", Name: "index_age",
+			Value: time.Since(status.LastModified).Truncate(time.Second).Seconds()})
+	}
+
+	if !status.StartTime.IsZero() {
+		values = append(values,
+			Value{Type: "gauge", Name: "starttime", Value: float64(status.StartTime.Unix())},
+			Value{Type: "gauge", Name: "uptime", Value: status.Uptime.Truncate(time.Second).Seconds()})
+	}
+
+	if *threadStats {
+		values = append(values, status.Threads.values()...)
+	}
+
+	return values
+}
+
+// The error returned when the server does not know about a core.
+type coreNotFoundError string
+
+func (core coreNotFoundError) Error() string {
+	return fmt.Sprintf("no data could be found for the index '%s'", string(core))
 }
 
 // Get an int value from a gabs query. Returns 0 if not found.
@@ -119,42 +734,57 @@ func getGabsInt(core, key string, gabs *gabs.Container) int {
 }
 
 // Query the specified Solr server and extract the relevant stats.
-func getStatus(core string, status *SolrStatus) error {
-
-	var prefix string
-	if *useHTTPS {
-		prefix = "https"
-	} else {
-		prefix = "http"
-	}
-
-	var coreUrl = fmt.Sprintf("%s://%s/solr/admin/cores?action=STATUS&core=%s&wt=json",
-		prefix,
-		*solrServer,
-		*coreName)
-
-	// Fetch core-specific stats.
-	data, err := getParsedJson(coreUrl)
-	if err != nil {
-		return err
+func getStatus(t *target, core string, status *SolrStatus) error {
+
+	var coreUrl = fmt.Sprintf("%s/admin/cores?action=STATUS&core=%s&wt=json",
+		t.baseURL(),
+		url.QueryEscape(core))
+
+	// Fetch core-specific stats, unless they were fetched for every core at once.
+	data := t.coresStatus
+	if data == nil {
+		var err error
+		if data, err = getParsedJson(coreUrl); err != nil {
+			return err
+		}
 	}
 
 	// Verify if we can pull data (since Solr won't generate an error if the core does not exist).
 	// Then, collect the core's data we are interested in.
 	if data.Path("status."+core+".name").String() != fmt.Sprintf("\"%s\"", core) {
-		return fmt.Errorf("no data could be found for the index '%s'", core)
+		return coreNotFoundError(core)
 	} else {
 		status.NumDocs = getGabsInt(core, "numDocs", data)
+		status.MaxDoc = getGabsInt(core, "maxDoc", data)
 		status.DeletedDocs = getGabsInt(core, "deletedDocs", data)
 		status.SegmentCount = getGabsInt(core, "segmentCount", data)
 		status.SizeInBytes = getGabsInt(core, "sizeInBytes", data)
+
+		status.LastModified = time.Time{}
+		if s, ok := data.Path("status." + core + ".index.lastModified").Data().(string); ok {
+			if t, err := time.Parse(time.RFC3339, s); err == nil {
+				status.LastModified = t
+			}
+		}
+
+		status.StartTime = time.Time{}
+		if s, ok := data.Path("status." + core + ".startTime").Data().(string); ok {
+			if t, err := time.Parse(time.RFC3339, s); err == nil {
+				status.StartTime = t
+			}
+		}
+		uptime, _ := data.Path("status." + core + ".uptime").Data().(float64)
+		status.Uptime = time.Duration(uptime) * time.Millisecond
 	}
 
-	// Fetch server-wide stats.
-	var serverUrl = fmt.Sprintf("%s://%s/solr/admin/info/threads", prefix, *solrServer)
-	data, err = getParsedJson(serverUrl)
-	if err != nil {
-		return err
+	// Fetch server-wide stats, unless they were fetched once for every core.
+	data = t.threadDump
+	if data == nil {
+		var serverUrl = t.baseURL() + "/admin/info/threads"
+		var err error
+		if data, err = getParsedJson(serverUrl); err != nil {
+			return err
+		}
 	}
 
 	// Count how many "Lucene Merge Thread" are listed.
@@ -166,34 +796,188 @@ func getStatus(core string, status *SolrStatus) error {
 		}
 	}
 	status.MergeThreadCount = mergeThreadCount
+	all, own := forceMergeThreads(data.S("system", "threadDump"), core)
+	t.forceMergeThreads = all
+	status.ForceMerge = detectForceMerge(t.server+"/"+core, status, own > 0)
+
+	if *threadStats {
+		status.Threads = countThreads(data.S("system", "threadDump"))
+	}
 
 	return nil
 }
 
-// Query the specified URL and return the body.
-func getParsedJson(url string) (*gabs.Container, error) {
-	var httpClient = &http.Client{Timeout: httpTimeoutSecs * time.Second}
+// Return the URL of the Solr webapp on the target server.
+func (t *target) baseURL() string {
+	var prefix string
+	if *useHTTPS {
+		prefix = "https"
+	} else {
+		prefix = "http"
+	}
+	// The zone of an IPv6 address, as in "[fe80::1%eth0]:8983", is escaped in URLs.
+	return fmt.Sprintf("%s://%s%s", prefix, strings.Replace(t.server, "%", "%25", 1), solrPath())
+}
+
+// Return the path Solr is served under, with a leading slash and without a
+// trailing one, empty when it is served at the root.
+func solrPath() string {
+	if p := strings.Trim(*contextRoot, "/"); p != "" {
+		return "/" + p
+	}
+	return ""
+}
 
-	r, err := httpClient.Get(url)
+// Return the hostname the values about the local host are reported under:
+// -hostname if set, else the collectd one, else the name of the machine.
+func localHostname() string {
+	if *hostName != "" {
+		return *hostName
+	}
+	if h := collectdEnv("COLLECTD_HOSTNAME"); h != "" {
+		return h
+	}
+	h, err := os.Hostname()
+	if err != nil || h == "" {
+		return "localhost"
+	}
+	formatted, err := formatHostname(h, *hostFormat)
 	if err != nil {
-		return nil, fmt.Errorf("cannot fetch url: %v", err)
+		warnf("cannot format hostname: %v", err)
+		return h
 	}
-	defer r.Body.Close()
+	return formatted
+}
 
-	if r.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server did not reply as expected: got status code %d, expected 200",
-			r.StatusCode)
+// Return the hostname in the given -hostname-format.
+func formatHostname(h, format string) (string, error) {
+	switch format {
+	case "":
+		return h, nil
+	case "short":
+		return strings.SplitN(h, ".", 2)[0], nil
+	case "fqdn":
+		if name, err := net.LookupCNAME(h); err == nil && strings.Contains(strings.TrimSuffix(name, "."), ".") {
+			return strings.TrimSuffix(name, "."), nil
+		}
+		// Without a canonical name, fall back to the name of the address.
+		return formatHostname(h, "reverse")
+	case "reverse":
+		addrs, err := net.LookupHost(h)
+		if err != nil {
+			return "", err
+		}
+		for _, addr := range addrs {
+			if ip := net.ParseIP(addr); ip == nil || ip.IsLoopback() {
+				continue
+			}
+			if names, err := net.LookupAddr(addr); err == nil && len(names) > 0 {
+				return strings.TrimSuffix(names[0], "."), nil
+			}
+		}
+		return "", fmt.Errorf("no reverse DNS name found for the addresses of '%s'", h)
 	}
+	return "", fmt.Errorf("unknown hostname format '%s'", format)
+}
 
-	body, err := ioutil.ReadAll(r.Body)
+// Return the time between collection cycles: -interval if set, else the
+// collectd one, which may have a fractional part.
+func pollInterval() time.Duration {
+	if cycleInterval > 0 {
+		return time.Duration(cycleInterval)
+	}
+	secs, err := strconv.ParseFloat(collectdEnv("COLLECTD_INTERVAL"), 64)
+	if err != nil || secs <= 0 {
+		return defaultIntervalSecs * time.Second
+	}
+	return time.Duration(secs * float64(time.Second))
+}
+
+// Return a duration in seconds, as collectd takes them.
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
+
+// Return the timeout of HTTP requests and other network operations.
+func httpTimeout() time.Duration {
+	return time.Duration(*timeoutSecs) * time.Second
+}
+
+// Query the specified URL and return the body. Failures that may be
+// transient are retried, see -max-attempts.
+func getParsedJson(url string) (*gabs.Container, error) {
+	start := time.Now()
+	failure := "http"
+	defer func() {
+		recordRequest(url, time.Since(start), failure)
+	}()
+
+	var body []byte
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		if body, retry, err = fetch(url); err == nil || !retry || attempt >= *maxAttempts {
+			break
+		}
+		delay := retryDelay(attempt)
+		debugf("%v, retrying in %v", err, delay)
+		select {
+		case <-time.After(delay):
+		case <-cycleContext.Done():
+		}
+	}
 	if err != nil {
-		return nil, fmt.Errorf("cannot read respose: %v", err)
+		return nil, err
 	}
+	dumpReply(url, body)
 
+	failure = "parse"
 	data, err := gabs.ParseJSON(body)
 	if err != nil {
 		return nil, fmt.Errorf("cannot parse json reply: %v", err)
 	}
+	failure = ""
 
 	return data, nil
 }
+
+// Fetch the specified URL, and return its body or whether the error may be
+// transient.
+func fetch(url string) ([]byte, bool, error) {
+	debugf("fetching %s", url)
+	if err := injectChaos(url); err != nil {
+		return nil, true, err
+	}
+
+	req, err := http.NewRequestWithContext(cycleContext, "GET", url, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("cannot fetch url: %v", err)
+	}
+	addHeaders(req)
+	if err := authenticate(req); err != nil {
+		return nil, false, err
+	}
+	if err := waitRate(req.URL.Host); err != nil {
+		return nil, false, err
+	}
+
+	r, err := solrClient(req.URL.Host).Do(req)
+	if err != nil {
+		return nil, cycleContext.Err() == nil, fmt.Errorf("cannot fetch url: %v", err)
+	}
+	defer r.Body.Close()
+
+	if r.StatusCode == http.StatusUnauthorized || r.StatusCode == http.StatusForbidden {
+		return nil, false, fmt.Errorf("server refused the credentials: got status code %d", r.StatusCode)
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, r.StatusCode >= 500 || r.StatusCode == http.StatusTooManyRequests,
+			fmt.Errorf("server did not reply as expected: got status code %d, expected 200", r.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, true, fmt.Errorf("cannot read respose: %v", err)
+	}
+	return body, false, nil
+}
@@ -0,0 +1,36 @@
+/*
+ * solr-status_test.go - helpers of the tests needing a Solr server
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Start a fake Solr server replying to the requests whose path ends with a
+// key of the replies, and whose query holds what follows the "?" of the key
+// if any, e.g. "/admin/collections?action=LISTALIASES", and return a target
+// polling it.
+func newTestTarget(t *testing.T, replies map[string]string) *target {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for key, reply := range replies {
+			path, query := key, ""
+			if i := strings.Index(key, "?"); i >= 0 {
+				path, query = key[:i], key[i+1:]
+			}
+			if strings.HasSuffix(r.URL.Path, path) && strings.Contains(r.URL.RawQuery, query) {
+				fmt.Fprint(w, reply)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return newTarget(strings.TrimPrefix(server.URL, "http://"))
+}
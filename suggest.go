@@ -0,0 +1,29 @@
+/*
+ * suggest.go - suggester and spellcheck component stats
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import "flag"
+
+var suggestStats = flag.Bool("suggest-stats", false, "collect suggester and spellcheck stats, for cores that have them")
+
+// Collect the suggester size and the /suggest and /spell handler stats of the
+// specified core. Cores without these components are silently skipped.
+// Solr does not expose the time taken by suggester builds.
+func getSuggestValues(t *target, core string) ([]Value, error) {
+	registry, err := getCoreMetrics(t, core, "QUERY.suggest.", "QUERY./suggest.", "QUERY./spell.")
+	if err != nil {
+		return nil, err
+	}
+
+	var values []Value
+	if v, ok := registry.S("QUERY.suggest.totalSizeInBytes").Data().(float64); ok {
+		values = append(values, Value{Type: "gauge", Name: "suggester_sizeinbytes", Value: v})
+	}
+	values = append(values, handlerValues(registry, "QUERY./suggest", "suggest")...)
+	values = append(values, handlerValues(registry, "QUERY./spell", "spell")...)
+
+	return values, nil
+}
@@ -0,0 +1,77 @@
+/*
+ * system.go - OS metrics from the system info handler
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+
+	"github.com/Jeffail/gabs"
+)
+
+var (
+	osStats  = flag.Bool("os-stats", false, "collect load average, memory, swap and file descriptor usage")
+	cpuStats = flag.Bool("cpu-stats", false, "collect the CPU load of the Solr process and of the whole system")
+)
+
+// OS stats we report, keyed by their name in the system info handler.
+var osFields = []struct{ key, name string }{
+	{"systemLoadAverage", "os_loadavg"},
+	{"freePhysicalMemorySize", "os_memory_free"},
+	{"totalPhysicalMemorySize", "os_memory_total"},
+	{"freeSwapSpaceSize", "os_swap_free"},
+	{"totalSwapSpaceSize", "os_swap_total"},
+	{"openFileDescriptorCount", "os_fd_open"},
+	{"maxFileDescriptorCount", "os_fd_max"},
+}
+
+// Query the system info handler.
+func getSystemInfo(t *target) (*gabs.Container, error) {
+	return getParsedJson(t.baseURL() + "/admin/info/system?wt=json")
+}
+
+// Collect the OS stats of the Solr server.
+func getOSValues(t *target, core string) ([]Value, error) {
+	data, err := getSystemInfo(t)
+	if err != nil {
+		return nil, err
+	}
+
+	system := data.S("system")
+	var values []Value
+	for _, f := range osFields {
+		if v, ok := system.S(f.key).Data().(float64); ok {
+			values = append(values, Value{Type: "gauge", Name: f.name, Value: v})
+		}
+	}
+
+	free, okFree := system.S("freeSwapSpaceSize").Data().(float64)
+	total, okTotal := system.S("totalSwapSpaceSize").Data().(float64)
+	if okFree && okTotal {
+		values = append(values, Value{Type: "gauge", Name: "os_swap_used", Value: total - free})
+	}
+
+	return values, nil
+}
+
+// Collect the CPU load (0 to 1) of the Solr JVM and of the whole system.
+// The JVM reports a negative load when it is not available yet.
+func getCPUValues(t *target, core string) ([]Value, error) {
+	data, err := getSystemInfo(t)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []Value
+	for _, f := range []struct{ key, name string }{
+		{"processCpuLoad", "cpu_process_load"},
+		{"systemCpuLoad", "cpu_system_load"},
+	} {
+		if v, ok := data.S("system", f.key).Data().(float64); ok && v >= 0 {
+			values = append(values, Value{Type: "gauge", Name: f.name, Value: v})
+		}
+	}
+	return values, nil
+}
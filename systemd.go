@@ -0,0 +1,65 @@
+/*
+ * systemd.go - readiness and watchdog notifications to systemd
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+)
+
+// Whether systemd was told the plugin is ready.
+var notifiedReady bool
+
+// Tell systemd how a cycle went, when it started the plugin with
+// Type=notify: the first cycle makes the service ready, and successful cycles
+// ping the watchdog, so that a wedged or failing plugin is restarted after
+// WatchdogSec.
+func notifyCycle(ok bool) {
+	state := "STATUS=last cycle succeeded"
+	if !ok {
+		state = "STATUS=last cycle failed"
+	}
+	if !notifiedReady {
+		state += "\nREADY=1"
+		notifiedReady = true
+	}
+	if ok && watchdogEnabled() {
+		state += "\nWATCHDOG=1"
+	}
+	sdNotify(state)
+}
+
+// Return whether systemd expects watchdog pings from this process.
+func watchdogEnabled() bool {
+	if os.Getenv("WATCHDOG_USEC") == "" {
+		return false
+	}
+	pid := os.Getenv("WATCHDOG_PID")
+	return pid == "" || pid == strconv.Itoa(os.Getpid())
+}
+
+// Send a notification to the socket systemd gave, if any.
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	// Abstract sockets are given with a leading "@".
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		warnf("cannot notify systemd: %v", err)
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		warnf("cannot notify systemd: %v", err)
+	}
+}
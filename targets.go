@@ -0,0 +1,249 @@
+/*
+ * targets.go - Solr servers polled by the plugin
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jeffail/gabs"
+)
+
+var (
+	targetsFile = flag.String("targets", "", "file listing the solr servers to poll, one per line (in addition to -server)")
+	concurrency = flag.Int("concurrency", 4, "how many servers are polled at the same time")
+	serverPort  = flag.Int("port", 0, "port of the solr servers given without one (80, or 443 with -https, by default)")
+	failovers   listFlag
+)
+
+func init() {
+	flag.Var(&failovers, "failover", "fallback server of the same cluster, tried in order when -server does not answer (comma-separated or repeated)")
+}
+
+// A Solr server we poll, along with what we remember about its cores.
+type target struct {
+	server   string   // as given, e.g. "solr1.example.com:8983"
+	host     string   // collectd hostname of its values, empty for the local one
+	cores    []string // cores to monitor instead of -core, if not nil
+	statuses map[string]*SolrStatus
+	labels   map[string]string // labels of its values, besides the -label ones
+	polled   []string          // cores polled on the last cycle
+	failed   bool              // no core, or not every core, could be collected on the last cycle
+
+	// Cycles failed in a row, and when the last one succeeded.
+	failures    int
+	lastSuccess time.Time
+	openUntil   time.Time // polling is suspended until then, see -breaker-failures
+
+	// Servers of the same cluster to fall back to, -server being the first.
+	failover []string
+
+	// Replies shared by all the cores during a cycle, nil when not fetched.
+	coresStatus *gabs.Container
+	threadDump  *gabs.Container
+
+	// Threads of the last thread dump forcing a merge, on any core.
+	forceMergeThreads int
+
+	// Cores found by the last discovery, when -core is omitted.
+	discovered   []string
+	discoveredAt time.Time
+	coreMissing  bool // a discovered core could not be found since
+
+	// When collectors with an interval override last ran, by name and core.
+	collectorRuns map[string]time.Time
+}
+
+func newTarget(server string) *target {
+	return &target{server: server, statuses: make(map[string]*SolrStatus), collectorRuns: make(map[string]time.Time)}
+}
+
+// Return the name a core of this target is known by in reports and logs.
+func (t *target) coreLabel(core string) string {
+	if t.host == "" {
+		return core
+	}
+	return t.host + "/" + core
+}
+
+// Build the list of targets from -server and -targets. When there are
+// several, each one reports under its own host name: the server name without
+// the port, unless that is ambiguous.
+func getTargets() ([]*target, error) {
+	servers := append([]string(nil), serverNames...)
+	if *targetsFile != "" {
+		s, err := readTargetsFile(*targetsFile)
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, s...)
+	}
+
+	var targets []*target
+	for _, spec := range servers {
+		server, labels, headers, err := parseTargetSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		if server, err = normalizeServer(server); err != nil {
+			return nil, err
+		}
+		t := newTarget(server)
+		t.labels = labels
+		setServerHeaders(server, headers)
+		targets = append(targets, t)
+	}
+	if len(failovers) > 0 {
+		if len(targets) != 1 {
+			return nil, fmt.Errorf("fallback servers require a single -server")
+		}
+		targets[0].failover = []string{targets[0].server}
+		for _, server := range failovers {
+			server, err := normalizeServer(server)
+			if err != nil {
+				return nil, err
+			}
+			targets[0].failover = append(targets[0].failover, server)
+			serverHeaders[server] = serverHeaders[targets[0].server]
+		}
+	}
+	labelTargets(targets)
+	return targets, nil
+}
+
+// Point the target to the first of its servers answering, and return its
+// position: 0 for the primary one, 1 for the first fallback and so on. When
+// none answers, the target is left on the primary one.
+func (t *target) failOver() int {
+	for i, server := range t.failover {
+		t.server = server
+		_, err := getParsedJson(t.baseURL() + "/admin/cores?action=STATUS&indexInfo=false&wt=json")
+		if err == nil {
+			return i
+		}
+		warnf("%s: %v", server, err)
+	}
+	t.server = t.failover[0]
+	return 0
+}
+
+// Return the targets of the given servers, sorted by server. Known targets
+// are reused, so that what they remember about their cores is kept, and the
+// ones no longer listed are forgotten.
+func syncTargets(known map[string]*target, servers []string) []*target {
+	listed := make(map[string]bool)
+	for _, server := range servers {
+		listed[server] = true
+		if known[server] == nil {
+			known[server] = newTarget(server)
+		}
+	}
+
+	var targets []*target
+	for server, t := range known {
+		if !listed[server] {
+			delete(known, server)
+			continue
+		}
+		targets = append(targets, t)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].server < targets[j].server
+	})
+	labelTargets(targets)
+	return targets
+}
+
+// Give each target its own host name, when there are several of them.
+func labelTargets(targets []*target) {
+	if len(targets) < 2 {
+		for _, t := range targets {
+			t.host = ""
+		}
+		return
+	}
+
+	hosts := make(map[string]int)
+	for _, t := range targets {
+		hosts[serverHost(t.server)]++
+	}
+	for _, t := range targets {
+		t.host = serverHost(t.server)
+		if hosts[t.host] > 1 {
+			t.host = strings.Replace(t.server, ":", "_", -1)
+		}
+	}
+}
+
+// Read a targets file: one server per line, optionally followed by its
+// labels, blank lines and lines starting with '#' are ignored.
+func readTargetsFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open targets file: %v", err)
+	}
+	defer f.Close()
+
+	var servers []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		servers = append(servers, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read targets file: %v", err)
+	}
+	return servers, nil
+}
+
+// Return a server as host:port, with IPv6 addresses in brackets and -port
+// added when it has no port, e.g. "[fe80::1]:8983" for "fe80::1".
+func normalizeServer(server string) (string, error) {
+	host, port := server, ""
+	if h, p, err := net.SplitHostPort(server); err == nil {
+		host, port = h, p
+	} else if ip := net.ParseIP(strings.Trim(strings.SplitN(server, "%", 2)[0], "[]")); ip != nil {
+		// An IPv6 address without a port, bracketed or not.
+		host = strings.Trim(server, "[]")
+	} else if strings.ContainsAny(server, ":[]") {
+		return "", fmt.Errorf("invalid server '%s': expected host, host:port, or [address]:port for an IPv6 address", server)
+	}
+
+	if host == "" || strings.ContainsAny(host, "/ ") {
+		return "", fmt.Errorf("invalid server '%s': expected host, host:port, or [address]:port for an IPv6 address", server)
+	}
+	if port == "" && *serverPort != 0 {
+		port = strconv.Itoa(*serverPort)
+	}
+	if port == "" {
+		if strings.Contains(host, ":") {
+			return "[" + host + "]", nil
+		}
+		return host, nil
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("invalid server '%s': the port must be a number between 1 and 65535", server)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// Return the host part of a server address.
+func serverHost(server string) string {
+	if host, _, err := net.SplitHostPort(server); err == nil {
+		return host
+	}
+	return server
+}
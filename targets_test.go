@@ -0,0 +1,51 @@
+/*
+ * targets_test.go - tests of the servers to poll
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import "testing"
+
+func TestNormalizeServer(t *testing.T) {
+	defer func(port int) { *serverPort = port }(*serverPort)
+
+	tests := []struct {
+		server   string
+		port     int
+		expected string // empty for an error
+	}{
+		{"solr1.example.com", 0, "solr1.example.com"},
+		{"solr1.example.com:8983", 0, "solr1.example.com:8983"},
+		{"solr1.example.com", 8983, "solr1.example.com:8983"},
+		{"solr1.example.com:7574", 8983, "solr1.example.com:7574"},
+		{"10.0.0.1", 8983, "10.0.0.1:8983"},
+		{"::1", 0, "[::1]"},
+		{"[::1]", 0, "[::1]"},
+		{"::1", 8983, "[::1]:8983"},
+		{"[::1]", 8983, "[::1]:8983"},
+		{"[::1]:7574", 8983, "[::1]:7574"},
+		{"2001:db8::1", 8983, "[2001:db8::1]:8983"},
+		{"fe80::1%eth0", 8983, "[fe80::1%eth0]:8983"},
+		{"[fe80::1%eth0]:8983", 0, "[fe80::1%eth0]:8983"},
+		{"solr1.example.com:0", 0, ""},
+		{"solr1.example.com:65536", 0, ""},
+		{"solr1.example.com:http", 0, ""},
+		{"solr1:8983:1", 0, ""},
+		{"http://solr1:8983", 0, ""},
+		{"solr1/solr", 0, ""},
+		{":8983", 0, ""},
+	}
+	for _, test := range tests {
+		*serverPort = test.port
+		got, err := normalizeServer(test.server)
+		switch {
+		case test.expected == "" && err == nil:
+			t.Errorf("normalizeServer(%s) with -port %d = %s, expected an error", test.server, test.port, got)
+		case test.expected != "" && err != nil:
+			t.Errorf("normalizeServer(%s) with -port %d: %v", test.server, test.port, err)
+		case got != test.expected:
+			t.Errorf("normalizeServer(%s) with -port %d = %s, expected %s", test.server, test.port, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+/*
+ * threads.go - thread dump breakdown by state and name
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/Jeffail/gabs"
+)
+
+var threadStats = flag.Bool("thread-stats", false, "collect thread counts by state and by notable name prefix")
+
+var threadStates = []string{"RUNNABLE", "BLOCKED", "WAITING", "TIMED_WAITING"}
+
+// Notable thread name prefixes, and the metric name they are reported as.
+var threadPrefixes = []struct{ prefix, name string }{
+	{"qtp", "qtp"},
+	{"commitScheduler", "commitscheduler"},
+	{"searcherExecutor", "searcherexecutor"},
+}
+
+// Thread counts from a thread dump.
+type threadCounts struct {
+	Total    int
+	States   map[string]int
+	Prefixes map[string]int
+}
+
+// Count the threads of a thread dump by state and by name prefix.
+func countThreads(dump *gabs.Container) threadCounts {
+	counts := threadCounts{States: make(map[string]int), Prefixes: make(map[string]int)}
+
+	for _, child := range dump.Children() {
+		cm := child.ChildrenMap()
+		name, ok := cm["name"].Data().(string)
+		if !ok {
+			continue
+		}
+
+		counts.Total++
+		if state, ok := cm["state"].Data().(string); ok {
+			counts.States[state]++
+		}
+		for _, p := range threadPrefixes {
+			if strings.HasPrefix(name, p.prefix) {
+				counts.Prefixes[p.name]++
+			}
+		}
+	}
+
+	return counts
+}
+
+// Return the thread counts as values.
+func (counts threadCounts) values() []Value {
+	values := []Value{{Type: "gauge", Name: "threads_total", Value: float64(counts.Total)}}
+	for _, state := range threadStates {
+		values = append(values, Value{Type: "gauge", Name: "threads_" + strings.ToLower(state),
+			Value: float64(counts.States[state])})
+	}
+	for _, p := range threadPrefixes {
+		values = append(values, Value{Type: "gauge", Name: "threads_" + p.name,
+			Value: float64(counts.Prefixes[p.name])})
+	}
+	return values
+}
@@ -0,0 +1,48 @@
+/*
+ * throttle.go - limit of the rate of the requests to every Solr server
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var maxRate = flag.Float64("max-rate", 0, "most requests per second sent to each solr server, for large configurations not to overload the admin APIs (0 is unlimited)")
+
+// When the next request to every server may be sent, by host:port.
+var (
+	nextRequest      = make(map[string]time.Time)
+	nextRequestMutex sync.Mutex
+)
+
+// Wait until a request may be sent to the server without exceeding
+// -max-rate, which spaces them evenly. Fail when the cycle ends first.
+func waitRate(host string) error {
+	if *maxRate <= 0 {
+		return nil
+	}
+
+	nextRequestMutex.Lock()
+	now := time.Now()
+	next := nextRequest[host]
+	if next.Before(now) {
+		next = now
+	}
+	nextRequest[host] = next.Add(time.Duration(float64(time.Second) / *maxRate))
+	nextRequestMutex.Unlock()
+
+	if next == now {
+		return nil
+	}
+	select {
+	case <-time.After(next.Sub(now)):
+		return nil
+	case <-cycleContext.Done():
+		return fmt.Errorf("cannot fetch url: cycle timeout reached while waiting for -max-rate")
+	}
+}
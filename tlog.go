@@ -0,0 +1,87 @@
+/*
+ * tlog.go - transaction log metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Solr's UpdateLog states, as reported by the TLOG.state gauge.
+const tlogStateReplaying = 0
+
+var tlogStats = flag.Bool("tlog-stats", false, "collect transaction log size, file count and replay status")
+
+// Collect the transaction log stats of the specified core. The size and
+// number of tlog files are only available when running on the Solr host.
+func getTlogValues(t *target, core string) ([]Value, error) {
+	registry, err := getCoreMetrics(t, core, "TLOG.")
+	if err != nil {
+		return nil, err
+	}
+
+	var values []Value
+	if v, ok := registry.S("TLOG.state").Data().(float64); ok {
+		replaying := 0.0
+		if v == tlogStateReplaying {
+			replaying = 1
+		}
+		values = append(values,
+			Value{Type: "gauge", Name: "tlog_state", Value: v},
+			Value{Type: "gauge", Name: "tlog_replaying", Value: replaying})
+	}
+	for _, f := range []struct{ key, name string }{
+		{"TLOG.replay.remaining.bytes", "tlog_replay_remaining_bytes"},
+		{"TLOG.replay.remaining.logs", "tlog_replay_remaining_logs"},
+		{"TLOG.buffered.ops", "tlog_buffered_ops"},
+	} {
+		if v, ok := registry.S(f.key).Data().(float64); ok {
+			values = append(values, Value{Type: "gauge", Name: f.name, Value: v})
+		}
+	}
+
+	dataDir, err := getDataDir(t, core)
+	if err != nil {
+		return values, err
+	}
+	tlogDir := filepath.Join(dataDir, "tlog")
+	if _, err := os.Stat(tlogDir); err != nil {
+		return values, fmt.Errorf("cannot read the transaction logs (is Solr running on this host?): %v", err)
+	}
+	files, _ := filepath.Glob(filepath.Join(tlogDir, "tlog.*"))
+
+	var size int64
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			size += info.Size()
+		}
+	}
+	values = append(values,
+		Value{Type: "gauge", Name: "tlog_files", Value: float64(len(files))},
+		Value{Type: "gauge", Name: "tlog_size", Value: float64(size)})
+
+	return values, nil
+}
+
+// Return the data directory of the specified core.
+func getDataDir(t *target, core string) (string, error) {
+	data, err := getParsedJson(fmt.Sprintf("%s/admin/cores?action=STATUS&core=%s&wt=json",
+		t.baseURL(),
+		url.QueryEscape(core)))
+	if err != nil {
+		return "", err
+	}
+
+	dataDir, ok := data.S("status", core, "dataDir").Data().(string)
+	if !ok || strings.TrimSpace(dataDir) == "" {
+		return "", fmt.Errorf("no data directory could be found for the index '%s'", core)
+	}
+	return dataDir, nil
+}
@@ -0,0 +1,136 @@
+/*
+ * tls.go - TLS settings of the connections to Solr
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+var (
+	tlsCert           = flag.String("tls-cert", "", "PEM client certificate to present to Solr servers requiring mutual TLS")
+	tlsKey            = flag.String("tls-key", "", "PEM private key of -tls-cert")
+	tlsPKCS12         = flag.String("tls-pkcs12", "", "PKCS#12 file holding the client certificate and its key, instead of -tls-cert and -tls-key")
+	tlsPKCS12Password = flag.String("tls-pkcs12-password", "", "password of -tls-pkcs12, or a file:, vault: or aws-sm: reference to it; prefer SOLR_STATUS_TLS_PKCS12_PASSWORD to the password itself")
+	tlsInsecure       = flag.Bool("tls-insecure-skip-verify", false, "do not verify the certificates of the Solr servers, which is insecure: for lab environments only")
+	tlsCA             = flag.String("tls-ca", "", "PEM file, or directory of PEM files, of the CA certificates to trust besides the system ones")
+)
+
+// Transport the clients of the Solr servers are made from.
+var solrTransport = http.DefaultTransport.(*http.Transport).Clone()
+
+// Build the transport of the requests to Solr from the TLS settings.
+func loadTLS() error {
+	if *tlsPKCS12 != "" && (*tlsCert != "" || *tlsKey != "") {
+		return fmt.Errorf("-tls-pkcs12 cannot be used with -tls-cert or -tls-key")
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		return fmt.Errorf("-tls-cert and -tls-key must be given together")
+	}
+
+	config := &tls.Config{}
+	switch {
+	case *tlsCert != "":
+		cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		if err != nil {
+			return fmt.Errorf("cannot load client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	case *tlsPKCS12 != "":
+		password, err := readSecret(*tlsPKCS12Password)
+		if err != nil {
+			return err
+		}
+		cert, err := loadPKCS12(*tlsPKCS12, password)
+		if err != nil {
+			return err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if *tlsCA != "" {
+		pool, err := loadCAs(*tlsCA)
+		if err != nil {
+			return err
+		}
+		config.RootCAs = pool
+	}
+	if *tlsInsecure {
+		warnf("-tls-insecure-skip-verify is set: the certificates of the Solr servers are not verified, which is insecure")
+		config.InsecureSkipVerify = true
+	}
+
+	resetClients()
+	solrTransport = http.DefaultTransport.(*http.Transport).Clone()
+	solrTransport.TLSClientConfig = config
+	return nil
+}
+
+// Load a client certificate, its chain and its key from a PKCS#12 file.
+func loadPKCS12(path, password string) (tls.Certificate, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("cannot read PKCS#12 file: %v", err)
+	}
+	key, cert, chain, err := pkcs12.DecodeChain(b, password)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("cannot decode PKCS#12 file: %v", err)
+	}
+
+	c := tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key, Leaf: cert}
+	for _, ca := range chain {
+		c.Certificate = append(c.Certificate, ca.Raw)
+	}
+	return c, nil
+}
+
+// Return the system CA certificates, along with the ones of a PEM file or of
+// every PEM file of a directory.
+func loadCAs(path string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	files := []string{path}
+	if fi, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("cannot read CA certificates: %v", err)
+	} else if fi.IsDir() {
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA certificates: %v", err)
+		}
+		files = files[:0]
+		for _, e := range entries {
+			if e.Mode().IsRegular() {
+				files = append(files, filepath.Join(path, e.Name()))
+			}
+		}
+	}
+
+	found := false
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA certificates: %v", err)
+		}
+		if pool.AppendCertsFromPEM(b) {
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no PEM certificate found in %s", path)
+	}
+	return pool, nil
+}
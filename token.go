@@ -0,0 +1,171 @@
+/*
+ * token.go - bearer token authentication, for the Solr JWT plugin
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jeffail/gabs"
+)
+
+var (
+	bearerToken      = flag.String("token", "", "bearer token to authenticate to Solr with, or a file:, vault: or aws-sm: reference to it; prefer SOLR_STATUS_TOKEN to the token itself, as the command line is visible to other users")
+	bearerTokenFile  = flag.String("token-file", "", "file the bearer token is read from, again whenever it changes")
+	oidcTokenURL     = flag.String("oidc-token-url", "", "token endpoint of the OpenID Connect provider bearer tokens are requested from, with the client credentials flow")
+	oidcClientID     = flag.String("oidc-client-id", "", "client id to request bearer tokens with")
+	oidcClientSecret = flag.String("oidc-client-secret", "", "client secret to request bearer tokens with, or a file:, vault: or aws-sm: reference to it; prefer SOLR_STATUS_OIDC_CLIENT_SECRET to the secret itself")
+	oidcScope        = flag.String("oidc-scope", "", "space-separated scopes to request bearer tokens for")
+)
+
+// Tokens are renewed when this share of their lifetime is left.
+const tokenRenewShare = 5
+
+// The -token and -oidc-client-secret credentials.
+var staticToken, oidcSecret secret
+
+// The current bearer token, and when it expires (or when the token file was
+// last modified). Empty when tokens are not used.
+var (
+	token        string
+	tokenExpiry  time.Time
+	tokenFileMod time.Time
+	tokenMutex   sync.Mutex
+)
+
+// Check the bearer token settings, and get a first token.
+func loadToken() error {
+	tokenMutex.Lock()
+	defer tokenMutex.Unlock()
+
+	token, tokenExpiry, tokenFileMod = "", time.Time{}, time.Time{}
+	n := 0
+	for _, s := range []string{*bearerToken, *bearerTokenFile, *oidcTokenURL} {
+		if s != "" {
+			n++
+		}
+	}
+	switch {
+	case n == 0:
+		return nil
+	case n > 1:
+		return fmt.Errorf("only one of -token, -token-file and -oidc-token-url can be given")
+	case *solrUser != "" || *krbKeytab != "" || *krbCCache != "":
+		return fmt.Errorf("bearer tokens cannot be used with -user or Kerberos")
+	case *oidcTokenURL != "" && *oidcClientID == "":
+		return fmt.Errorf("-oidc-token-url requires -oidc-client-id")
+	}
+	if err := staticToken.load(*bearerToken); err != nil {
+		return err
+	}
+	if err := oidcSecret.load(*oidcClientSecret); err != nil {
+		return err
+	}
+	return refreshToken()
+}
+
+// Get a new bearer token if the current one is about to expire, or the
+// token file changed. Called with tokenMutex held.
+func refreshToken() error {
+	switch {
+	case *bearerToken != "":
+		token = staticToken.get()
+	case *bearerTokenFile != "":
+		fi, err := os.Stat(*bearerTokenFile)
+		if err != nil {
+			return fmt.Errorf("cannot read token file: %v", err)
+		}
+		if token != "" && fi.ModTime().Equal(tokenFileMod) {
+			return nil
+		}
+		b, err := ioutil.ReadFile(*bearerTokenFile)
+		if err != nil {
+			return fmt.Errorf("cannot read token file: %v", err)
+		}
+		token, tokenFileMod = strings.TrimSpace(string(b)), fi.ModTime()
+	case *oidcTokenURL != "":
+		if token != "" && time.Now().Before(tokenExpiry) {
+			return nil
+		}
+		t, lifetime, err := requestToken()
+		if err != nil {
+			return err
+		}
+		token, tokenExpiry = t, time.Now().Add(lifetime-lifetime/tokenRenewShare)
+		debugf("got a bearer token valid for %v", lifetime)
+	}
+	return nil
+}
+
+// Request a token with the OAuth 2.0 client credentials flow, and return it
+// along with its lifetime.
+func requestToken() (string, time.Duration, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if *oidcScope != "" {
+		form.Set("scope", *oidcScope)
+	}
+	req, err := http.NewRequestWithContext(cycleContext, "POST", *oidcTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, fmt.Errorf("cannot request token: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(*oidcClientID), url.QueryEscape(oidcSecret.get()))
+
+	client := &http.Client{Timeout: httpTimeout()}
+	r, err := client.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("cannot request token: %v", err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("cannot request token: got status code %d, expected 200", r.StatusCode)
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return "", 0, fmt.Errorf("cannot read token reply: %v", err)
+	}
+	data, err := gabs.ParseJSON(body)
+	if err != nil {
+		return "", 0, fmt.Errorf("cannot parse token reply: %v", err)
+	}
+
+	t, _ := data.S("access_token").Data().(string)
+	if t == "" {
+		return "", 0, fmt.Errorf("cannot request token: no access_token in reply")
+	}
+	// Tokens without an expiry are requested again every hour.
+	lifetime := time.Hour
+	if secs, ok := data.S("expires_in").Data().(float64); ok && secs > 0 {
+		lifetime = time.Duration(secs) * time.Second
+	}
+	return t, lifetime, nil
+}
+
+// Add the bearer token, if any, to a request.
+func addToken(req *http.Request) error {
+	tokenMutex.Lock()
+	defer tokenMutex.Unlock()
+
+	if *bearerToken == "" && *bearerTokenFile == "" && *oidcTokenURL == "" {
+		return nil
+	}
+	if err := refreshToken(); err != nil {
+		if token == "" {
+			return err
+		}
+		// The current token may still be accepted.
+		warnf("%v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
@@ -0,0 +1,418 @@
+/*
+ * update.go - release update check and in-place self-update
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Jeffail/gabs"
+)
+
+const updateCheckInterval = 24 * time.Hour
+const updateTimeoutSecs = 60
+
+// Set at build time with -ldflags "-X main.version=x.y.z".
+var version = "dev"
+
+var (
+	checkUpdates = flag.Bool("check-updates", false, "check daily for a newer release and report it as a metric")
+	updateURL    = flag.String("update-url", "https://api.github.com/repos/fascoli/solr-status/releases/latest",
+		"release endpoint used to look for updates")
+)
+
+// Set to 1 when the last check found a newer release.
+var newerVersionAvailable int32
+
+// A release, as returned by the release endpoint.
+type release struct {
+	Version string
+	Assets  map[string]string // asset name -> download URL
+}
+
+// Return the client of the requests to the release endpoint. Unlike the one of
+// the Solr servers, it never sends the Solr credentials or -header headers.
+func updateClient() *http.Client {
+	return &http.Client{Timeout: updateTimeoutSecs * time.Second}
+}
+
+// Fetch a file of the release endpoint.
+func downloadRelease(url string, w io.Writer) error {
+	r, err := updateClient().Get(url)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return fmt.Errorf("got status code %d, expected 200", r.StatusCode)
+	}
+	_, err = io.Copy(w, r.Body)
+	return err
+}
+
+// Fetch the latest release from the release endpoint.
+func getLatestRelease() (*release, error) {
+	var b bytes.Buffer
+	if err := downloadRelease(*updateURL, &b); err != nil {
+		return nil, fmt.Errorf("cannot fetch the latest release: %v", err)
+	}
+	data, err := gabs.ParseJSON(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse the latest release: %v", err)
+	}
+
+	tag, ok := data.S("tag_name").Data().(string)
+	if !ok {
+		return nil, fmt.Errorf("no release tag found at %s", *updateURL)
+	}
+
+	rel := &release{Version: tag, Assets: make(map[string]string)}
+	for _, asset := range data.S("assets").Children() {
+		name, _ := asset.S("name").Data().(string)
+		downloadURL, _ := asset.S("browser_download_url").Data().(string)
+		if name != "" && downloadURL != "" {
+			rel.Assets[name] = downloadURL
+		}
+	}
+	return rel, nil
+}
+
+// Parse a "v1.2.3" like version into its numeric components.
+func parseVersion(v string) []int {
+	var parts []int
+	for _, p := range strings.Split(strings.TrimPrefix(v, "v"), ".") {
+		n, err := strconv.Atoi(strings.SplitN(p, "-", 2)[0])
+		if err != nil {
+			break
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// Return true if version a is newer than version b. Development builds are
+// never considered outdated.
+func newerVersion(a, b string) bool {
+	va, vb := parseVersion(a), parseVersion(b)
+	if len(vb) == 0 {
+		return false
+	}
+	for i := 0; i < len(va); i++ {
+		if i >= len(vb) || va[i] > vb[i] {
+			return true
+		}
+		if va[i] < vb[i] {
+			return false
+		}
+	}
+	return false
+}
+
+// Check for a newer release every day, until the process exits.
+func runUpdateChecks() {
+	for {
+		rel, err := getLatestRelease()
+		if err != nil {
+			warnf("update check: %v", err)
+		} else if newerVersion(rel.Version, version) {
+			atomic.StoreInt32(&newerVersionAvailable, 1)
+		} else {
+			atomic.StoreInt32(&newerVersionAvailable, 0)
+		}
+		time.Sleep(updateCheckInterval)
+	}
+}
+
+// Return the update check result as values.
+func updateValues() []Value {
+	if !*checkUpdates {
+		return nil
+	}
+	return []Value{
+		{Type: "gauge", Name: "newer_version_available", Value: float64(atomic.LoadInt32(&newerVersionAvailable))},
+	}
+}
+
+// Names the current platform may be called in release asset names.
+func platformNames() (goos []string, goarch []string) {
+	goos = []string{runtime.GOOS}
+	if runtime.GOOS == "darwin" {
+		goos = append(goos, "macos")
+	}
+
+	switch runtime.GOARCH {
+	case "amd64":
+		goarch = []string{"amd64"}
+	case "386":
+		goarch = []string{"386", "i386", "x86"}
+	case "arm64":
+		goarch = []string{"arm64", "aarch64"}
+	case "arm":
+		goarch = []string{"armv7", "armv6", "arm"}
+	default:
+		goarch = []string{runtime.GOARCH}
+	}
+	return goos, goarch
+}
+
+// Find the release asset built for the current OS and architecture.
+func findAsset(rel *release) (string, string, error) {
+	goos, goarch := platformNames()
+	if name := matchAsset(rel.Assets, goos, goarch); name != "" {
+		return name, rel.Assets[name], nil
+	}
+	return "", "", fmt.Errorf("release %s has no binary for %s/%s", rel.Version, runtime.GOOS, runtime.GOARCH)
+}
+
+// Return the name of the asset built for one of the OS and architecture
+// names, architectures being tried in order, or "" if there is none. Names
+// are compared with the words of the asset names, e.g. "linux" and "arm"
+// for "solr-status_linux_arm.tar.gz", so that "arm" does not match "arm64".
+func matchAsset(assets map[string]string, goos, goarch []string) string {
+	names := make([]string, 0, len(assets))
+	for name := range assets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, arch := range goarch {
+		for _, name := range names {
+			lower := strings.ToLower(name)
+			if strings.HasSuffix(lower, ".sha256") || strings.HasSuffix(lower, ".asc") {
+				continue
+			}
+			// x86_64, the only architecture name holding a separator, is amd64.
+			words := strings.FieldsFunc(strings.Replace(lower, "x86_64", "amd64", -1), func(r rune) bool {
+				return r == '_' || r == '-' || r == '.' || r == ' '
+			})
+			if containsAny(words, goos) && contains(words, arch) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// Tell whether any of the values is in the list.
+func containsAny(list, values []string) bool {
+	for _, v := range values {
+		if contains(list, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the SHA-256 checksum of a release asset, from its ".sha256" asset
+// as written by sha256sum: the hex checksum, optionally followed by the name.
+func getChecksum(rel *release, name string) (string, error) {
+	checksumURL, ok := rel.Assets[name+".sha256"]
+	if !ok {
+		return "", fmt.Errorf("release %s has no checksum for %s: not installed", rel.Version, name)
+	}
+	var b bytes.Buffer
+	if err := downloadRelease(checksumURL, &b); err != nil {
+		return "", fmt.Errorf("cannot download the checksum of %s: %v", name, err)
+	}
+	return parseChecksum(b.String())
+}
+
+// Parse a sha256sum line, e.g. "<64 hex digits>  solr-status_linux_amd64".
+func parseChecksum(s string) (string, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("invalid checksum: empty")
+	}
+	sum := strings.ToLower(fields[0])
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid checksum '%s': expected %d hex digits", fields[0], 2*sha256.Size)
+	}
+	return sum, nil
+}
+
+// Download the latest release and replace the running binary with it.
+func selfUpdate() error {
+	rel, err := getLatestRelease()
+	if err != nil {
+		return err
+	}
+	if !newerVersion(rel.Version, version) {
+		fmt.Printf("solr-status %s is up to date.\n", version)
+		return nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot locate the running binary: %v", err)
+	}
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return fmt.Errorf("cannot locate the running binary: %v", err)
+	}
+	if err := installRelease(rel, exe); err != nil {
+		return err
+	}
+
+	fmt.Printf("solr-status updated from %s to %s.\n", version, rel.Version)
+	return nil
+}
+
+// Replace the binary at exe with the one of the release built for the current
+// OS and architecture, unpacked from its archive if it comes in one.
+func installRelease(rel *release, exe string) error {
+	name, downloadURL, err := findAsset(rel)
+	if err != nil {
+		return err
+	}
+	checksum, err := getChecksum(rel, name)
+	if err != nil {
+		return err
+	}
+
+	// Download next to the binary, so that the final rename stays on the same filesystem.
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".solr-status-update-*")
+	if err != nil {
+		return fmt.Errorf("cannot create temporary file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	if err := downloadRelease(downloadURL, io.MultiWriter(tmp, h)); err != nil {
+		tmp.Close()
+		return fmt.Errorf("cannot download %s: %v", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("cannot write %s: %v", tmp.Name(), err)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != checksum {
+		return fmt.Errorf("%s does not match its checksum (got %s, expected %s): not installed", name, sum, checksum)
+	}
+
+	binary := tmp.Name()
+	if archiveFormat(name) != "" {
+		bin, err := os.CreateTemp(filepath.Dir(exe), ".solr-status-update-*")
+		if err != nil {
+			return fmt.Errorf("cannot create temporary file: %v", err)
+		}
+		defer os.Remove(bin.Name())
+		err = unpackBinary(tmp.Name(), archiveFormat(name), bin)
+		if closeErr := bin.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("cannot unpack %s: %v", name, err)
+		}
+		binary = bin.Name()
+	}
+	if err := os.Chmod(binary, 0755); err != nil {
+		return fmt.Errorf("cannot make %s executable: %v", binary, err)
+	}
+
+	// A running binary cannot be overwritten on Windows, but it can be renamed,
+	// and renamed back should the new one fail to take its place.
+	var old string
+	if runtime.GOOS == "windows" {
+		old = exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return fmt.Errorf("cannot move the running binary away: %v", err)
+		}
+	}
+	if err := os.Rename(binary, exe); err != nil {
+		if old != "" {
+			if restoreErr := os.Rename(old, exe); restoreErr != nil {
+				return fmt.Errorf("cannot replace %s: %v, nor put it back from %s: %v", exe, err, old, restoreErr)
+			}
+		}
+		return fmt.Errorf("cannot replace %s: %v", exe, err)
+	}
+	return nil
+}
+
+// Return the format of a release archive, "tar.gz" or "zip", or "" for a
+// bare binary.
+func archiveFormat(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz") || strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	}
+	return ""
+}
+
+// Return the name of the binary in release archives.
+func binaryName() string {
+	if runtime.GOOS == "windows" {
+		return "solr-status.exe"
+	}
+	return "solr-status"
+}
+
+// Copy the binary out of a release archive, wherever it is in it.
+func unpackBinary(archive, format string, w io.Writer) error {
+	if format == "zip" {
+		z, err := zip.OpenReader(archive)
+		if err != nil {
+			return err
+		}
+		defer z.Close()
+		for _, f := range z.File {
+			if f.Mode().IsRegular() && path.Base(f.Name) == binaryName() {
+				r, err := f.Open()
+				if err != nil {
+					return err
+				}
+				defer r.Close()
+				_, err = io.Copy(w, r)
+				return err
+			}
+		}
+		return fmt.Errorf("no %s in the archive", binaryName())
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("no %s in the archive", binaryName())
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeReg && path.Base(hdr.Name) == binaryName() {
+			_, err = io.Copy(w, tr)
+			return err
+		}
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ * update_handler.go - update handler (indexing pipeline) metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import "flag"
+
+var (
+	updateStats = flag.Bool("update-stats", false, "collect commit, add, delete and error stats of the update handler")
+	commitStats = flag.Bool("commit-stats", false, "collect separate hard, soft and searcher-opening commit counters")
+)
+
+// Update handler stats we report, keyed by their name in the metrics API.
+var updateFields = []struct{ key, typ, name string }{
+	{"commits", "derive", "update_commits"},
+	{"autoCommits", "derive", "update_autocommits"},
+	{"softAutoCommits", "derive", "update_softautocommits"},
+	{"docsPending", "gauge", "update_docspending"},
+	{"cumulativeAdds", "derive", "update_adds"},
+	{"cumulativeDeletesById", "derive", "update_deletesbyid"},
+	{"cumulativeDeletesByQuery", "derive", "update_deletesbyquery"},
+	{"rollbacks", "derive", "update_rollbacks"},
+	{"cumulativeErrors", "derive", "update_errors"},
+}
+
+// Collect the update handler stats of the specified core.
+func getUpdateValues(t *target, core string) ([]Value, error) {
+	registry, err := getCoreMetrics(t, core, "UPDATE.updateHandler.")
+	if err != nil {
+		return nil, err
+	}
+
+	var values []Value
+	for _, f := range updateFields {
+		if v, ok := metricCount(registry.S("UPDATE.updateHandler." + f.key)); ok {
+			values = append(values, Value{Type: f.typ, Name: f.name, Value: v})
+		}
+	}
+	return values, nil
+}
+
+// Collect separate commit counters for the specified core. Solr counts
+// automatic hard and soft commits separately, but explicit commits as a whole;
+// commits that opened a searcher (soft commits and hard commits with
+// openSearcher=true) are counted through the searchers they opened.
+func getCommitValues(t *target, core string) ([]Value, error) {
+	registry, err := getCoreMetrics(t, core, "UPDATE.updateHandler.", "SEARCHER.new")
+	if err != nil {
+		return nil, err
+	}
+
+	var values []Value
+	for _, f := range []struct{ key, name string }{
+		{"UPDATE.updateHandler.autoCommits", "commits_hard_auto"},
+		{"UPDATE.updateHandler.softAutoCommits", "commits_soft_auto"},
+		{"UPDATE.updateHandler.commits", "commits_explicit"},
+		{"SEARCHER.new", "commits_opensearcher"},
+	} {
+		if v, ok := metricCount(registry.S(f.key)); ok {
+			values = append(values, Value{Type: "derive", Name: f.name, Value: v})
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,179 @@
+/*
+ * update_test.go - tests of the release update check
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestMatchAsset(t *testing.T) {
+	assets := map[string]string{
+		"solr-status_linux_arm64.tar.gz":        "",
+		"solr-status_linux_arm64.tar.gz.sha256": "",
+		"solr-status_linux_arm.tar.gz":          "",
+		"solr-status_linux_x86_64.tar.gz":       "",
+		"solr-status_darwin_arm64.tar.gz":       "",
+		"solr-status_windows_amd64.zip":         "",
+		"solr-status-macos-amd64":               "",
+	}
+	tests := []struct {
+		goos, goarch []string
+		expected     string
+	}{
+		{[]string{"linux"}, []string{"armv7", "armv6", "arm"}, "solr-status_linux_arm.tar.gz"},
+		{[]string{"linux"}, []string{"arm64", "aarch64"}, "solr-status_linux_arm64.tar.gz"},
+		{[]string{"linux"}, []string{"amd64"}, "solr-status_linux_x86_64.tar.gz"},
+		{[]string{"windows"}, []string{"amd64"}, "solr-status_windows_amd64.zip"},
+		{[]string{"darwin", "macos"}, []string{"amd64"}, "solr-status-macos-amd64"},
+		{[]string{"linux"}, []string{"386", "i386", "x86"}, ""},
+		{[]string{"freebsd"}, []string{"arm64", "aarch64"}, ""},
+	}
+	for _, test := range tests {
+		// Map order is random: the same asset must be picked every time.
+		for i := 0; i < 20; i++ {
+			if name := matchAsset(assets, test.goos, test.goarch); name != test.expected {
+				t.Fatalf("matchAsset(%v, %v) = %q, expected %q", test.goos, test.goarch, name, test.expected)
+			}
+		}
+	}
+}
+
+func TestParseChecksum(t *testing.T) {
+	const sum = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	tests := []struct {
+		line     string
+		expected string // empty for an error
+	}{
+		{sum + "\n", sum},
+		{sum + "  solr-status_linux_amd64.tar.gz\n", sum},
+		{"9F86D081884C7D659A2FEAA0C55AD015A3BF4F1B2B0B822CD15D6C15B0F00A08 *file", sum},
+		{"", ""},
+		{"deadbeef  file", ""},
+		{"not a checksum", ""},
+	}
+	for _, test := range tests {
+		sum, err := parseChecksum(test.line)
+		if (err == nil) != (test.expected != "") || sum != test.expected {
+			t.Errorf("parseChecksum(%q) = %q, %v, expected %q", test.line, sum, err, test.expected)
+		}
+	}
+}
+
+func TestNewerVersion(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"v1.2.0", "v1.1.9", true},
+		{"v1.2.0", "v1.2.0", false},
+		{"v1.2.1", "1.2", true},
+		{"v1.10.0", "v1.9.0", true},
+		{"v1.0.0", "dev", false},
+		{"v1.0.0-rc1", "v0.9.0", true},
+	}
+	for _, test := range tests {
+		if newer := newerVersion(test.a, test.b); newer != test.expected {
+			t.Errorf("newerVersion(%q, %q) = %v, expected %v", test.a, test.b, newer, test.expected)
+		}
+	}
+}
+
+// Return a release archive holding the binary in a directory, as release
+// tools make them.
+func releaseArchive(t *testing.T, format string, binary []byte) []byte {
+	var b bytes.Buffer
+	name := "solr-status_v2.0.0/" + binaryName()
+	switch format {
+	case "tar.gz":
+		gz := gzip.NewWriter(&b)
+		tw := tar.NewWriter(gz)
+		tw.WriteHeader(&tar.Header{Name: "solr-status_v2.0.0/README.md", Mode: 0644, Size: 5, Typeflag: tar.TypeReg})
+		tw.Write([]byte("hello"))
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(binary)), Typeflag: tar.TypeReg})
+		tw.Write(binary)
+		tw.Close()
+		gz.Close()
+	case "zip":
+		zw := zip.NewWriter(&b)
+		w, _ := zw.Create("solr-status_v2.0.0/README.md")
+		w.Write([]byte("hello"))
+		w, _ = zw.Create(name)
+		w.Write(binary)
+		zw.Close()
+	default:
+		return binary
+	}
+	return b.Bytes()
+}
+
+func TestInstallRelease(t *testing.T) {
+	const binary = "#!/bin/sh\necho v2.0.0\n"
+	tests := []struct {
+		format   string // archive format, empty for a bare binary
+		asset    []byte
+		checksum string // empty for the right one
+		expected string // content of the program after the update
+	}{
+		{"", releaseArchive(t, "", []byte(binary)), "", binary},
+		{"tar.gz", releaseArchive(t, "tar.gz", []byte(binary)), "", binary},
+		{"zip", releaseArchive(t, "zip", []byte(binary)), "", binary},
+		{"tar.gz", releaseArchive(t, "tar.gz", []byte(binary)), hex.EncodeToString(make([]byte, sha256.Size)), "v1"},
+		{"zip", releaseArchive(t, "", []byte("not a zip")), "", "v1"},
+	}
+	for _, test := range tests {
+		name := "solr-status_" + runtime.GOOS + "_" + runtime.GOARCH
+		if test.format != "" {
+			name += "." + test.format
+		}
+		checksum := test.checksum
+		if checksum == "" {
+			sum := sha256.Sum256(test.asset)
+			checksum = hex.EncodeToString(sum[:])
+		}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/"+name+".sha256" {
+				w.Write([]byte(checksum + "  " + name + "\n"))
+			} else {
+				w.Write(test.asset)
+			}
+		}))
+		rel := &release{Version: "v2.0.0", Assets: map[string]string{
+			name:             server.URL + "/" + name,
+			name + ".sha256": server.URL + "/" + name + ".sha256",
+		}}
+
+		exe := filepath.Join(t.TempDir(), binaryName())
+		if err := ioutil.WriteFile(exe, []byte("v1"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		err := installRelease(rel, exe)
+		server.Close()
+		if (err == nil) != (test.expected != "v1") {
+			t.Errorf("installRelease(%s): %v", name, err)
+		}
+		content, err := ioutil.ReadFile(exe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != test.expected {
+			t.Errorf("installRelease(%s) left %q, expected %q", name, content, test.expected)
+		}
+		if leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(exe), ".solr-status-update-*")); len(leftovers) > 0 {
+			t.Errorf("installRelease(%s) left %v", name, leftovers)
+		}
+	}
+}
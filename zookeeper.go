@@ -0,0 +1,183 @@
+/*
+ * zookeeper.go - ZooKeeper ensemble health metrics
+ * Copyright (c) 2018 Matteo Fascoli <matteo@fascoli.com>
+ */
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jeffail/gabs"
+)
+
+const zkDefaultPort = "2181"
+
+var (
+	zkStats = flag.Bool("zk-stats", false, "collect ZooKeeper ensemble health (SolrCloud)")
+	zkHost  = flag.String("zkhost", "", "ZooKeeper connection string, queried directly instead of through Solr, and used to discover the live Solr nodes when no server is specified")
+)
+
+// Health of a single ZooKeeper server.
+type zkNode struct {
+	Up          bool
+	Leader      bool
+	Latency     float64
+	Outstanding float64
+}
+
+// Collect the health of the ZooKeeper ensemble, either by asking every
+// server directly (with -zkhost) or through Solr's ZK status API.
+func getZKValues(t *target, core string) ([]Value, error) {
+	var nodes []zkNode
+	var err error
+	if *zkHost != "" {
+		nodes = getZKNodesDirect(*zkHost)
+	} else {
+		nodes, err = getZKNodesFromSolr(t)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	up, leader := 0, 0
+	var latency, outstanding float64
+	for _, node := range nodes {
+		if !node.Up {
+			continue
+		}
+		up++
+		if node.Leader {
+			leader = 1
+		}
+		latency += node.Latency
+		outstanding += node.Outstanding
+	}
+	if up > 0 {
+		latency /= float64(up)
+	}
+
+	return []Value{
+		{Instance: "zookeeper", Type: "gauge", Name: "nodes_total", Value: float64(len(nodes))},
+		{Instance: "zookeeper", Type: "gauge", Name: "nodes_up", Value: float64(up)},
+		{Instance: "zookeeper", Type: "gauge", Name: "leader_present", Value: float64(leader)},
+		{Instance: "zookeeper", Type: "gauge", Name: "avg_latency", Value: latency},
+		{Instance: "zookeeper", Type: "gauge", Name: "outstanding_requests", Value: outstanding},
+	}, nil
+}
+
+// Query Solr's ZK status API (Solr 8.2 or later).
+func getZKNodesFromSolr(t *target) ([]zkNode, error) {
+	data, err := getParsedJson(t.baseURL() + "/admin/zookeeper/status?wt=json")
+	if err != nil {
+		return nil, err
+	}
+	if !data.Exists("zkStatus") {
+		return nil, fmt.Errorf("no ZooKeeper status found in the reply (requires SolrCloud and Solr 8.2 or later)")
+	}
+
+	var nodes []zkNode
+	for _, detail := range data.S("zkStatus", "details").Children() {
+		node := zkNode{Up: boolValue(detail.S("ok")) == 1}
+		if state, ok := detail.S("zk_server_state").Data().(string); ok {
+			node.Leader = state == "leader" || state == "standalone"
+		}
+		node.Latency, _ = numberValue(detail.S("zk_avg_latency"))
+		node.Outstanding, _ = numberValue(detail.S("zk_outstanding_requests"))
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// Ask every server of a ZooKeeper connection string for its health.
+func getZKNodesDirect(connection string) []zkNode {
+	var nodes []zkNode
+	for _, addr := range zkAddresses(connection) {
+		stats, err := zkMntr(addr)
+		if err != nil {
+			nodes = append(nodes, zkNode{})
+			continue
+		}
+
+		node := zkNode{Up: true}
+		node.Leader = stats["zk_server_state"] == "leader" || stats["zk_server_state"] == "standalone"
+		node.Latency, _ = strconv.ParseFloat(stats["zk_avg_latency"], 64)
+		node.Outstanding, _ = strconv.ParseFloat(stats["zk_outstanding_requests"], 64)
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// Split a ZooKeeper connection string (e.g. "zk1:2181,zk2/solr") into host:port addresses.
+func zkAddresses(connection string) []string {
+	if i := strings.Index(connection, "/"); i >= 0 {
+		connection = connection[:i]
+	}
+
+	var addrs []string
+	for _, host := range strings.Split(connection, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(host, zkDefaultPort)
+		}
+		addrs = append(addrs, host)
+	}
+	return addrs
+}
+
+// Return the chroot of a ZooKeeper connection string, e.g. "/solr", if any.
+func zkChroot(connection string) string {
+	if i := strings.Index(connection, "/"); i >= 0 {
+		return strings.TrimRight(connection[i:], "/")
+	}
+	return ""
+}
+
+// Send the "mntr" four letter word to a ZooKeeper server and parse its reply.
+// The server must allow it (4lw.commands.whitelist on ZooKeeper 3.5+).
+func zkMntr(addr string) (map[string]string, error) {
+	conn, err := net.DialTimeout("tcp", addr, httpTimeout())
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to %s: %v", addr, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(httpTimeout()))
+
+	if _, err := conn.Write([]byte("mntr")); err != nil {
+		return nil, fmt.Errorf("cannot send mntr to %s: %v", addr, err)
+	}
+
+	stats := make(map[string]string)
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "\t", 2)
+		if len(fields) == 2 {
+			stats[fields[0]] = strings.TrimSpace(fields[1])
+		}
+	}
+	if len(stats) == 0 {
+		return nil, fmt.Errorf("no reply to mntr from %s (is it whitelisted?)", addr)
+	}
+	return stats, nil
+}
+
+// Return the value of a number, or of a string holding a number.
+func numberValue(c *gabs.Container) (float64, bool) {
+	switch v := c.Data().(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}